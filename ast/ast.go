@@ -4,10 +4,14 @@ package ast
 import(
     "github.com/Sumz-K/Go-Interpreter/token"
     "bytes"
+    "fmt"
+    "strings"
 )
 type Node interface {
     TokenValue() string //every node in our AST has to return the token value corresponding to it
     String() string //to print out nodes
+    Pos() token.Position //where the node starts in the source
+    End() token.Position //just past where the node ends
 }
 
 type Statement interface {
@@ -34,6 +38,20 @@ func (p* Program) TokenValue() string {
     }
 }
 
+func (p *Program) Pos() token.Position {
+    if len(p.Statements) > 0 {
+        return p.Statements[0].Pos()
+    }
+    return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+    if len(p.Statements) > 0 {
+        return p.Statements[len(p.Statements)-1].End()
+    }
+    return token.Position{}
+}
+
 func (p *Program) String() string {
     var buffer bytes.Buffer
     for _,stmt:=range p.Statements {
@@ -55,8 +73,10 @@ the expression on the rhs i.e. 5
 
 
 
+// let x = 5; or const x = 5;, a const is a let the program may not assign to or
+// bind again in the same scope, which the parser checks
 type LetStmt struct {
-    Token token.Token // the LET token 
+    Token token.Token // the LET or CONST token
     Name *Identifier  
     Value Expression
 }
@@ -74,6 +94,24 @@ func (ls *LetStmt) TokenValue() string {
 
 func (ls *LetStmt) StatementNode() {}
 
+func (ls *LetStmt) IsConst() bool {
+    return ls.Token.Type==token.CONST
+}
+
+func (ls *LetStmt) Pos() token.Position {
+    return ls.Token.Pos
+}
+
+func (ls *LetStmt) End() token.Position {
+    if ls.Value!=nil {
+        return ls.Value.End()
+    }
+    if ls.Name!=nil {
+        return ls.Name.End()
+    }
+    return ls.Token.End
+}
+
 func (ls *LetStmt) String() string {
     var buf bytes.Buffer
     buf.WriteString(ls.TokenValue()+ " ")
@@ -93,6 +131,14 @@ func (id *Identifier) TokenValue() string {
 
 func (id *Identifier) ExpressionNode() {}
 
+func (id *Identifier) Pos() token.Position {
+    return id.Token.Pos
+}
+
+func (id *Identifier) End() token.Position {
+    return id.Token.End
+}
+
 func(id *Identifier) String() string {
     return id.Value
 }
@@ -109,6 +155,17 @@ func (rs *ReturnStmt) TokenValue() string {
     return rs.Token.Value
 }
 
+func (rs *ReturnStmt) Pos() token.Position {
+    return rs.Token.Pos
+}
+
+func (rs *ReturnStmt) End() token.Position {
+    if rs.ReturnValue!=nil {
+        return rs.ReturnValue.End()
+    }
+    return rs.Token.End
+}
+
 
 func(rs *ReturnStmt) String() string {
     var buf bytes.Buffer
@@ -133,6 +190,20 @@ func (es *ExpressionStmt) TokenValue() string {
 
 func (es *ExpressionStmt) StatementNode() {}
 
+func (es *ExpressionStmt) Pos() token.Position {
+    if es.Expression!=nil {
+        return es.Expression.Pos()
+    }
+    return es.Token.Pos
+}
+
+func (es *ExpressionStmt) End() token.Position {
+    if es.Expression!=nil {
+        return es.Expression.End()
+    }
+    return es.Token.End
+}
+
 func (es *ExpressionStmt) String() string {
     if es.Expression!=nil {
         return es.Expression.String()
@@ -153,6 +224,14 @@ func (il *IntegerLiteral) TokenValue() string {
     return il.Token.Value
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+    return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() token.Position {
+    return il.Token.End
+}
+
 func (il *IntegerLiteral) String() string {
     return il.Token.Value
 }
@@ -171,6 +250,17 @@ func (pe *PrefixExpression) TokenValue() string {
     return pe.Token.Value
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+    return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+    if pe.Right!=nil {
+        return pe.Right.End()
+    }
+    return pe.Token.End
+}
+
 func (pe *PrefixExpression) String() string {
     var buf bytes.Buffer
 
@@ -206,6 +296,20 @@ func (ie *InfixExpression) TokenValue() string {
 
 func (ie *InfixExpression) ExpressionNode() {}
 
+func (ie *InfixExpression) Pos() token.Position {
+    if ie.LeftExpr!=nil {
+        return ie.LeftExpr.Pos()
+    }
+    return ie.Token.Pos
+}
+
+func (ie *InfixExpression) End() token.Position {
+    if ie.RightExpr!=nil {
+        return ie.RightExpr.End()
+    }
+    return ie.Token.End
+}
+
 func (ie* InfixExpression) String() string {
     var buf bytes.Buffer
     buf.WriteString("(")
@@ -217,6 +321,72 @@ func (ie* InfixExpression) String() string {
     return buf.String()
 }
 
+// a && b and a || b. They are not an InfixExpression because the right operand
+// is only evaluated when the left one does not decide the result already
+type LogicalExpression struct {
+    Token token.Token // the operator token, && or ||
+    Left Expression
+    Operator string
+    Right Expression
+}
+
+func (le *LogicalExpression) TokenValue() string {
+    return le.Token.Value
+}
+
+func (le *LogicalExpression) ExpressionNode() {}
+
+func (le *LogicalExpression) Pos() token.Position {
+    if le.Left!=nil {
+        return le.Left.Pos()
+    }
+    return le.Token.Pos
+}
+
+func (le *LogicalExpression) End() token.Position {
+    if le.Right!=nil {
+        return le.Right.End()
+    }
+    return le.Token.End
+}
+
+func (le *LogicalExpression) String() string {
+    return "("+le.Left.String()+" "+le.Operator+" "+le.Right.String()+")"
+}
+
+// x = v, x += v or a[i] = v. Target is an Identifier or an IndexExpression, the
+// parser rejects anything else
+type AssignExpression struct {
+    Token token.Token // the operator token, = or one of += -= *= /=
+    Target Expression
+    Operator string
+    Value Expression
+}
+
+func (ae *AssignExpression) TokenValue() string {
+    return ae.Token.Value
+}
+
+func (ae *AssignExpression) ExpressionNode() {}
+
+func (ae *AssignExpression) Pos() token.Position {
+    if ae.Target!=nil {
+        return ae.Target.Pos()
+    }
+    return ae.Token.Pos
+}
+
+func (ae *AssignExpression) End() token.Position {
+    if ae.Value!=nil {
+        return ae.Value.End()
+    }
+    return ae.Token.End
+}
+
+func (ae *AssignExpression) String() string {
+    return "("+ae.Target.String()+" "+ae.Operator+" "+ae.Value.String()+")"
+}
+
 type Boolean struct {
     Token token.Token
     Value bool 
@@ -228,18 +398,35 @@ func (b* Boolean) TokenValue() string {
 
 func (b *Boolean) ExpressionNode() {}
 
+func (b *Boolean) Pos() token.Position {
+    return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+    return b.Token.End
+}
+
 func(b* Boolean) String() string {
     return b.TokenValue()
 }
 
 
 type BlockStmt struct {
-    Token token.Token
+    Token token.Token // the { token
     Statements []Statement
+    Rbrace token.Token // the closing }, or EOF if the block was never closed
 }
 
 func (bs *BlockStmt) StatementNode() {}
 
+func (bs *BlockStmt) Pos() token.Position {
+    return bs.Token.Pos
+}
+
+func (bs *BlockStmt) End() token.Position {
+    return bs.Rbrace.End
+}
+
 func (bs *BlockStmt) TokenValue() string {
     return bs.Token.Value
 }
@@ -254,6 +441,132 @@ func (bs *BlockStmt) String() string{
     return buf.String()
 }
 
+// while (x < 10) { ... }
+type WhileStmt struct {
+    Token token.Token // the while token
+    Condition Expression
+    Body *BlockStmt
+}
+
+func (ws *WhileStmt) StatementNode() {}
+
+func (ws *WhileStmt) TokenValue() string {
+    return ws.Token.Value
+}
+
+func (ws *WhileStmt) Pos() token.Position {
+    return ws.Token.Pos
+}
+
+func (ws *WhileStmt) End() token.Position {
+    if ws.Body!=nil {
+        return ws.Body.End()
+    }
+    return ws.Token.End
+}
+
+func (ws *WhileStmt) String() string {
+    return "while ("+ws.Condition.String()+") "+ws.Body.String()
+}
+
+// for (let i = 0; i < n; i += 1) { ... }, Init, Condition and Post may each
+// be left out. Init and Post are a let or an expression statement
+type ForStmt struct {
+    Token token.Token // the for token
+    Init Statement
+    Condition Expression // nil loops until a break or return
+    Post Statement
+    Body *BlockStmt
+}
+
+func (fs *ForStmt) StatementNode() {}
+
+func (fs *ForStmt) TokenValue() string {
+    return fs.Token.Value
+}
+
+func (fs *ForStmt) Pos() token.Position {
+    return fs.Token.Pos
+}
+
+func (fs *ForStmt) End() token.Position {
+    if fs.Body!=nil {
+        return fs.Body.End()
+    }
+    return fs.Token.End
+}
+
+func (fs *ForStmt) String() string {
+    var buf bytes.Buffer
+    buf.WriteString("for (")
+    if fs.Init!=nil {
+        buf.WriteString(strings.TrimSuffix(fs.Init.String(),";"))
+    }
+    buf.WriteString("; ")
+    if fs.Condition!=nil {
+        buf.WriteString(fs.Condition.String())
+    }
+    buf.WriteString("; ")
+    if fs.Post!=nil {
+        buf.WriteString(strings.TrimSuffix(fs.Post.String(),";"))
+    }
+    buf.WriteString(") ")
+    buf.WriteString(fs.Body.String())
+    return buf.String()
+}
+
+// for (x in collection) { ... }, over the elements of an array or the keys of a hash
+type ForInStmt struct {
+    Token token.Token // the for token
+    Variable *Identifier
+    Iterable Expression
+    Body *BlockStmt
+}
+
+func (fs *ForInStmt) StatementNode() {}
+
+func (fs *ForInStmt) TokenValue() string {
+    return fs.Token.Value
+}
+
+func (fs *ForInStmt) Pos() token.Position {
+    return fs.Token.Pos
+}
+
+func (fs *ForInStmt) End() token.Position {
+    if fs.Body!=nil {
+        return fs.Body.End()
+    }
+    return fs.Token.End
+}
+
+func (fs *ForInStmt) String() string {
+    return "for ("+fs.Variable.String()+" in "+fs.Iterable.String()+") "+fs.Body.String()
+}
+
+// break and continue, which of the two is told by Token.Type
+type BranchStmt struct {
+    Token token.Token
+}
+
+func (bs *BranchStmt) StatementNode() {}
+
+func (bs *BranchStmt) TokenValue() string {
+    return bs.Token.Value
+}
+
+func (bs *BranchStmt) Pos() token.Position {
+    return bs.Token.Pos
+}
+
+func (bs *BranchStmt) End() token.Position {
+    return bs.Token.End
+}
+
+func (bs *BranchStmt) String() string {
+    return bs.Token.Value+";"
+}
+
 type IfExpression struct {
     Token token.Token
     Condition Expression
@@ -267,12 +580,26 @@ func (ifexp *IfExpression) TokenValue() string {
     return ifexp.Token.Value
 }
 
+func (ifexp *IfExpression) Pos() token.Position {
+    return ifexp.Token.Pos
+}
+
+func (ifexp *IfExpression) End() token.Position {
+    if ifexp.Alternative!=nil {
+        return ifexp.Alternative.End()
+    }
+    if ifexp.Consequence!=nil {
+        return ifexp.Consequence.End()
+    }
+    return ifexp.Token.End
+}
+
 func (ifexp *IfExpression) String() string {
     var buf bytes.Buffer
     buf.WriteString("if ")
     buf.WriteString(ifexp.Condition.String())
     buf.WriteString(" ")
-    buf.WriteString(ifexp.Condition.String())
+    buf.WriteString(ifexp.Consequence.String())
 
     if ifexp.Alternative!=nil {
         buf.WriteString(" else ")
@@ -294,6 +621,17 @@ func (fn *Function) TokenValue() string {
 
 func (fn *Function) ExpressionNode() {}
 
+func (fn *Function) Pos() token.Position {
+    return fn.Token.Pos
+}
+
+func (fn *Function) End() token.Position {
+    if fn.Body!=nil {
+        return fn.Body.End()
+    }
+    return fn.Token.End
+}
+
 func (fn *Function) String() string {
     var buf bytes.Buffer
     buf.WriteString("fn")
@@ -313,10 +651,22 @@ type CallExpr struct {
     Token token.Token // The '(' token
     Function Expression // a call can be of the form add(2,3) but it can also be of the form fn(x,y){x+y;} (2,3). Now if the function part is made an expression instead of identifier(which also is an expression) we can validate both these calls. Both "add" and "fn(x,y) {x+y;}" ar eessentially still 'expressions'. One is an Identifier struct other is a Function struct but both fulfill the Expression interface
     Arguments []Expression  // no * because Expression is an interface and interfaces already hold references to concrete types
+    Rparen token.Token // the closing )
 }
 
 func (ce *CallExpr) ExpressionNode() {}
 
+func (ce *CallExpr) Pos() token.Position {
+    if ce.Function!=nil {
+        return ce.Function.Pos()
+    }
+    return ce.Token.Pos
+}
+
+func (ce *CallExpr) End() token.Position {
+    return ce.Rparen.End
+}
+
 func (ce *CallExpr) TokenValue() string {
     return ce.Token.Value
 }
@@ -334,3 +684,214 @@ func (ce *CallExpr) String() string {
 }
 
 
+
+// BadExpr stands in for an expression that failed to parse. Partial holds
+// whatever was built before the error, it may be nil
+type BadExpr struct {
+    Token token.Token // the token where the expression started
+    Partial Expression
+    To token.Position // where parsing gave up
+}
+
+func (be *BadExpr) ExpressionNode() {}
+
+func (be *BadExpr) TokenValue() string {
+    return be.Token.Value
+}
+
+func (be *BadExpr) Pos() token.Position {
+    return be.Token.Pos
+}
+
+func (be *BadExpr) End() token.Position {
+    return be.To
+}
+
+func (be *BadExpr) String() string {
+    return "<bad expression>"
+}
+
+// BadStmt is the statement level counterpart of BadExpr
+type BadStmt struct {
+    Token token.Token
+    Partial Statement
+    To token.Position
+}
+
+func (bs *BadStmt) StatementNode() {}
+
+func (bs *BadStmt) TokenValue() string {
+    return bs.Token.Value
+}
+
+func (bs *BadStmt) Pos() token.Position {
+    return bs.Token.Pos
+}
+
+func (bs *BadStmt) End() token.Position {
+    return bs.To
+}
+
+func (bs *BadStmt) String() string {
+    return "<bad statement>"
+}
+
+type StringLiteral struct {
+    Token token.Token
+    Value string // the text with escapes already decoded
+}
+
+func (sl *StringLiteral) ExpressionNode() {}
+
+func (sl *StringLiteral) TokenValue() string {
+    return sl.Token.Value
+}
+
+func (sl *StringLiteral) Pos() token.Position {
+    return sl.Token.Pos
+}
+
+func (sl *StringLiteral) End() token.Position {
+    return sl.Token.End
+}
+
+// prints the literal back in source form, quoted and escaped
+func (sl *StringLiteral) String() string {
+    var buf bytes.Buffer
+    buf.WriteByte('"')
+    for _,r:=range sl.Value {
+        switch r {
+        case '"':
+            buf.WriteString(`\"`)
+        case '\\':
+            buf.WriteString(`\\`)
+        case '\n':
+            buf.WriteString(`\n`)
+        case '\t':
+            buf.WriteString(`\t`)
+        case '\r':
+            buf.WriteString(`\r`)
+        default:
+            if r<0x20 || r==0x7f {
+                fmt.Fprintf(&buf,`\u{%x}`,r)
+            } else {
+                buf.WriteRune(r)
+            }
+        }
+    }
+    buf.WriteByte('"')
+    return buf.String()
+}
+
+type ArrayLiteral struct {
+    Token token.Token // the [ token
+    Elements []Expression
+    Rbracket token.Token
+}
+
+func (al *ArrayLiteral) ExpressionNode() {}
+
+func (al *ArrayLiteral) TokenValue() string {
+    return al.Token.Value
+}
+
+func (al *ArrayLiteral) Pos() token.Position {
+    return al.Token.Pos
+}
+
+func (al *ArrayLiteral) End() token.Position {
+    return al.Rbracket.End
+}
+
+func (al *ArrayLiteral) String() string {
+    var buf bytes.Buffer
+    buf.WriteString("[")
+    for i,el:=range al.Elements {
+        if i>0 {
+            buf.WriteString(", ")
+        }
+        buf.WriteString(el.String())
+    }
+    buf.WriteString("]")
+    return buf.String()
+}
+
+// arr[1], like a call the left side can be any expression: [1,2][0] or f()[0]
+type IndexExpression struct {
+    Token token.Token // the [ token
+    Left Expression
+    Index Expression
+    Rbracket token.Token
+}
+
+func (ie *IndexExpression) ExpressionNode() {}
+
+func (ie *IndexExpression) TokenValue() string {
+    return ie.Token.Value
+}
+
+func (ie *IndexExpression) Pos() token.Position {
+    if ie.Left!=nil {
+        return ie.Left.Pos()
+    }
+    return ie.Token.Pos
+}
+
+func (ie *IndexExpression) End() token.Position {
+    return ie.Rbracket.End
+}
+
+func (ie *IndexExpression) String() string {
+    var buf bytes.Buffer
+    buf.WriteString("(")
+    buf.WriteString(ie.Left.String())
+    buf.WriteString("[")
+    buf.WriteString(ie.Index.String())
+    buf.WriteString("])")
+    return buf.String()
+}
+
+// {"name": "monkey", 1: true}, pairs are kept in source order
+type HashLiteral struct {
+    Token token.Token // the { token
+    Pairs []*HashPair
+    Rbrace token.Token
+}
+
+type HashPair struct {
+    Key Expression
+    Value Expression
+}
+
+func (hl *HashLiteral) ExpressionNode() {}
+
+func (hl *HashLiteral) TokenValue() string {
+    return hl.Token.Value
+}
+
+func (hl *HashLiteral) Pos() token.Position {
+    return hl.Token.Pos
+}
+
+func (hl *HashLiteral) End() token.Position {
+    return hl.Rbrace.End
+}
+
+func (hl *HashLiteral) String() string {
+    var buf bytes.Buffer
+    buf.WriteString("{")
+    for i,pair:=range hl.Pairs {
+        if i>0 {
+            buf.WriteString(", ")
+        }
+        if pair.Key!=nil {
+            buf.WriteString(pair.Key.String())
+        }
+        buf.WriteString(": ")
+        if pair.Value!=nil {
+            buf.WriteString(pair.Value.String())
+        }
+    }
+    buf.WriteString("}")
+    return buf.String()
+}
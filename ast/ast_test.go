@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"bytes"
+	"strings"
 	"github.com/Sumz-K/Go-Interpreter/token"
 	"testing"
 )
@@ -25,4 +27,63 @@ func TestString(t *testing.T) {
 	if program.String() != "let myVar = anotherVar;" { 
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}		
-}
\ No newline at end of file
+}
+func TestFprint(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStmt{
+				Token: token.Token{Type: token.LET, Value: "let", Pos: token.Position{Line: 1, Column: 1}},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENTIFIER, Value: "x", Pos: token.Position{Line: 1, Column: 5}, End: token.Position{Line: 1, Column: 6}},
+					Value: "x",
+				},
+				Value: &IntegerLiteral{
+					Token: token.Token{Type: token.INTEGER, Value: "5", Pos: token.Position{Line: 1, Column: 9}, End: token.Position{Line: 1, Column: 10}},
+					Value: 5,
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	Fprint(&buf, program)
+
+	expected := `*ast.Program 1:1-1:10
+    Statements: (len = 1)
+        0: *ast.LetStmt 1:1-1:10
+            Name: *ast.Identifier 1:5-1:6
+                Value: "x"
+            Value: *ast.IntegerLiteral 1:9-1:10
+                Value: 5
+`
+	if buf.String() != expected {
+		t.Errorf("Fprint wrong, expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENTIFIER, Value: name}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStmt{Expression: &AssignExpression{Target: ident("x"), Operator: "=", Value: ident("y")}},
+			&ExpressionStmt{Expression: &IfExpression{Condition: ident("c"), Consequence: &BlockStmt{}}},
+			&ExpressionStmt{Expression: &Function{Params: []*Identifier{ident("p")}, Body: &BlockStmt{
+				Statements: []Statement{&ExpressionStmt{Expression: ident("q")}},
+			}}},
+		},
+	}
+
+	var names []string
+	Inspect(program, func(node Node) bool {
+		if id, ok := node.(*Identifier); ok {
+			names = append(names, id.Value)
+		}
+		_, isFunction := node.(*Function)
+		return !isFunction
+	})
+	if strings.Join(names, " ") != "x y c" {
+		t.Errorf("expected to visit x y c and skip the function, got %v", names)
+	}
+}
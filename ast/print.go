@@ -0,0 +1,83 @@
+package ast
+
+import (
+    "fmt"
+    "io"
+    "reflect"
+
+    "github.com/Sumz-K/Go-Interpreter/token"
+)
+
+var (
+    tokenType = reflect.TypeOf(token.Token{})
+    positionType = reflect.TypeOf(token.Position{})
+)
+
+// Fprint writes the tree rooted at node to w, one node per line indented by depth,
+// each with its source span and its non token fields:
+//
+//	*ast.LetStmt 1:1-1:13
+//	    Name: *ast.Identifier 1:5-1:9
+//	        Value: "five"
+//	    Value: *ast.IntegerLiteral 1:12-1:13
+//	        Value: 5
+func Fprint(w io.Writer, node Node) {
+    printValue(w,reflect.ValueOf(node),0)
+}
+
+func printValue(w io.Writer, v reflect.Value, depth int) {
+    switch v.Kind() {
+    case reflect.Interface:
+        if v.IsNil() {
+            fmt.Fprintln(w,"nil")
+            return
+        }
+        printValue(w,v.Elem(),depth)
+    case reflect.Ptr:
+        if v.IsNil() {
+            fmt.Fprintln(w,"nil")
+            return
+        }
+        if node,ok:=v.Interface().(Node);ok {
+            end:=node.End()
+            end.File="" // already shown with the start
+            fmt.Fprintf(w,"%s %s-%s\n",v.Type(),node.Pos(),end)
+        } else {
+            fmt.Fprintf(w,"%s\n",v.Type())
+        }
+        printFields(w,v.Elem(),depth+1)
+    case reflect.Slice:
+        fmt.Fprintf(w,"(len = %d)\n",v.Len())
+        for i:=0;i<v.Len();i++ {
+            indent(w,depth+1)
+            fmt.Fprintf(w,"%d: ",i)
+            printValue(w,v.Index(i),depth+1)
+        }
+    case reflect.String:
+        fmt.Fprintf(w,"%q\n",v.String())
+    default:
+        fmt.Fprintf(w,"%v\n",v.Interface())
+    }
+}
+
+// tokens and positions are left out, the span printed next to each node covers them
+func printFields(w io.Writer, v reflect.Value, depth int) {
+    if v.Kind()!=reflect.Struct {
+        return
+    }
+    for i:=0;i<v.NumField();i++ {
+        field:=v.Type().Field(i)
+        if !field.IsExported() || field.Type==tokenType || field.Type==positionType {
+            continue
+        }
+        indent(w,depth)
+        fmt.Fprintf(w,"%s: ",field.Name)
+        printValue(w,v.Field(i),depth)
+    }
+}
+
+func indent(w io.Writer, depth int) {
+    for i:=0;i<depth;i++ {
+        io.WriteString(w,"    ")
+    }
+}
@@ -0,0 +1,88 @@
+package ast
+
+// Inspect walks the tree rooted at node depth first, calling f for every node
+// before its children. When f returns false the children of that node are skipped.
+// Missing children are not visited, and neither is what a BadExpr or BadStmt holds
+func Inspect(node Node, f func(Node) bool) {
+    if node==nil || !f(node) {
+        return
+    }
+
+    switch n:=node.(type) {
+    case *Program:
+        for _,s:=range n.Statements {
+            Inspect(s,f)
+        }
+    case *LetStmt:
+        if n.Name!=nil {
+            Inspect(n.Name,f)
+        }
+        Inspect(n.Value,f)
+    case *ReturnStmt:
+        Inspect(n.ReturnValue,f)
+    case *ExpressionStmt:
+        Inspect(n.Expression,f)
+    case *BlockStmt:
+        for _,s:=range n.Statements {
+            Inspect(s,f)
+        }
+    case *WhileStmt:
+        Inspect(n.Condition,f)
+        inspectBlock(n.Body,f)
+    case *ForStmt:
+        Inspect(n.Init,f)
+        Inspect(n.Condition,f)
+        Inspect(n.Post,f)
+        inspectBlock(n.Body,f)
+    case *ForInStmt:
+        if n.Variable!=nil {
+            Inspect(n.Variable,f)
+        }
+        Inspect(n.Iterable,f)
+        inspectBlock(n.Body,f)
+    case *PrefixExpression:
+        Inspect(n.Right,f)
+    case *InfixExpression:
+        Inspect(n.LeftExpr,f)
+        Inspect(n.RightExpr,f)
+    case *LogicalExpression:
+        Inspect(n.Left,f)
+        Inspect(n.Right,f)
+    case *AssignExpression:
+        Inspect(n.Target,f)
+        Inspect(n.Value,f)
+    case *IfExpression:
+        Inspect(n.Condition,f)
+        inspectBlock(n.Consequence,f)
+        inspectBlock(n.Alternative,f)
+    case *Function:
+        for _,p:=range n.Params {
+            Inspect(p,f)
+        }
+        inspectBlock(n.Body,f)
+    case *CallExpr:
+        Inspect(n.Function,f)
+        for _,a:=range n.Arguments {
+            Inspect(a,f)
+        }
+    case *ArrayLiteral:
+        for _,e:=range n.Elements {
+            Inspect(e,f)
+        }
+    case *IndexExpression:
+        Inspect(n.Left,f)
+        Inspect(n.Index,f)
+    case *HashLiteral:
+        for _,pair:=range n.Pairs {
+            Inspect(pair.Key,f)
+            Inspect(pair.Value,f)
+        }
+    }
+}
+
+// a nil *BlockStmt would reach Inspect as a non nil Node
+func inspectBlock(block *BlockStmt, f func(Node) bool) {
+    if block!=nil {
+        Inspect(block,f)
+    }
+}
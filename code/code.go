@@ -0,0 +1,254 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// a flat stream of opcodes each followed by its operands, big endian
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode=iota // push constants[operand]
+	OpPop // discard the top of the stack
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpLessEqual
+	OpGreaterEqual
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpMinus // unary -
+	OpBang // unary !
+	OpBitNot // unary ~
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJumpNotTruthy // pop, jump to operand if it is not truthy
+	OpJump // jump to operand
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree // push a value captured by the running closure
+	OpGetLocalCell // push the value in the cell a local holds
+	OpSetLocalCell
+	OpGetFreeCell // push the value in a cell captured by the running closure
+	OpSetFreeCell
+
+	OpArray // build an array from the top operand elements
+	OpHash // build a hash from the top operand elements, keys and values alternating
+	OpIndex
+	OpIterate // replace the top of the stack with an array of the values a for-in loop goes through
+	OpSetIndex // set an element of an array or hash to the top operand, leaving the value
+	OpDupPair // push copies of the top two operands
+
+	OpCall // call the function below the operand arguments
+	OpReturnValue // return the top of the stack
+	OpReturn // return null
+	OpClosure // wrap a compiled function and the free values on top of the stack into a closure
+	OpCurrentClosure // push the running closure, how a function refers to itself
+)
+
+// Definition says how an opcode is spelled in listings and how wide each operand is in bytes
+type Definition struct {
+	Name string
+	OperandWidths []int
+}
+
+var definitions=map[Opcode]*Definition{
+	OpConstant: {"OpConstant",[]int{2}},
+	OpPop: {"OpPop",[]int{}},
+
+	OpAdd: {"OpAdd",[]int{}},
+	OpSub: {"OpSub",[]int{}},
+	OpMul: {"OpMul",[]int{}},
+	OpDiv: {"OpDiv",[]int{}},
+	OpEqual: {"OpEqual",[]int{}},
+	OpNotEqual: {"OpNotEqual",[]int{}},
+	OpGreaterThan: {"OpGreaterThan",[]int{}},
+	OpLessThan: {"OpLessThan",[]int{}},
+	OpLessEqual: {"OpLessEqual",[]int{}},
+	OpGreaterEqual: {"OpGreaterEqual",[]int{}},
+	OpMod: {"OpMod",[]int{}},
+	OpPow: {"OpPow",[]int{}},
+	OpBitAnd: {"OpBitAnd",[]int{}},
+	OpBitOr: {"OpBitOr",[]int{}},
+	OpBitXor: {"OpBitXor",[]int{}},
+	OpShiftLeft: {"OpShiftLeft",[]int{}},
+	OpShiftRight: {"OpShiftRight",[]int{}},
+	OpMinus: {"OpMinus",[]int{}},
+	OpBang: {"OpBang",[]int{}},
+	OpBitNot: {"OpBitNot",[]int{}},
+
+	OpTrue: {"OpTrue",[]int{}},
+	OpFalse: {"OpFalse",[]int{}},
+	OpNull: {"OpNull",[]int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy",[]int{2}},
+	OpJump: {"OpJump",[]int{2}},
+
+	OpGetGlobal: {"OpGetGlobal",[]int{2}},
+	OpSetGlobal: {"OpSetGlobal",[]int{2}},
+	OpGetLocal: {"OpGetLocal",[]int{1}},
+	OpSetLocal: {"OpSetLocal",[]int{1}},
+	OpGetBuiltin: {"OpGetBuiltin",[]int{1}},
+	OpGetFree: {"OpGetFree",[]int{1}},
+	OpGetLocalCell: {"OpGetLocalCell",[]int{1}},
+	OpSetLocalCell: {"OpSetLocalCell",[]int{1}},
+	OpGetFreeCell: {"OpGetFreeCell",[]int{1}},
+	OpSetFreeCell: {"OpSetFreeCell",[]int{1}},
+
+	OpArray: {"OpArray",[]int{2}},
+	OpHash: {"OpHash",[]int{2}},
+	OpIndex: {"OpIndex",[]int{}},
+	OpIterate: {"OpIterate",[]int{}},
+	OpSetIndex: {"OpSetIndex",[]int{}},
+	OpDupPair: {"OpDupPair",[]int{}},
+
+	OpCall: {"OpCall",[]int{1}},
+	OpReturnValue: {"OpReturnValue",[]int{}},
+	OpReturn: {"OpReturn",[]int{}},
+	OpClosure: {"OpClosure",[]int{2,1}},
+	OpCurrentClosure: {"OpCurrentClosure",[]int{}},
+}
+
+func Lookup(op byte) (*Definition,error) {
+	def,ok:=definitions[Opcode(op)]
+	if !ok {
+		return nil,fmt.Errorf("opcode %d undefined",op)
+	}
+	return def,nil
+}
+
+// Make encodes one instruction. Operands that do not fit their width are truncated,
+// the compiler checks limits before emitting, and jump targets once they are patched
+func Make(op Opcode, operands ...int) []byte {
+	def,ok:=definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length:=1
+	for _,w:=range def.OperandWidths {
+		length+=w
+	}
+
+	instruction:=make([]byte,length)
+	instruction[0]=byte(op)
+
+	offset:=1
+	for i,o:=range operands {
+		width:=def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:],uint16(o))
+		case 1:
+			instruction[offset]=byte(o)
+		}
+		offset+=width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of one instruction whose opcode has already been
+// read, ins starts right after the opcode. It also returns how many bytes were read
+func ReadOperands(def *Definition, ins Instructions) ([]int,int) {
+	operands:=make([]int,len(def.OperandWidths))
+	offset:=0
+
+	for i,width:=range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i]=int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i]=int(ReadUint8(ins[offset:]))
+		}
+		offset+=width
+	}
+	return operands,offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// one instruction per line, prefixed by its offset: 0003 OpConstant 1
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i:=0
+	for i<len(ins) {
+		def,err:=Lookup(ins[i])
+		if err!=nil {
+			fmt.Fprintf(&out,"ERROR: %s\n",err)
+			i++
+			continue
+		}
+
+		operands,read:=ReadOperands(def,ins[i+1:])
+		fmt.Fprintf(&out,"%04d %s\n",i,ins.fmtInstruction(def,operands))
+		i+=1+read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount:=len(def.OperandWidths)
+	if len(operands)!=operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",len(operands),operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d",def.Name,operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d",def.Name,operands[0],operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n",def.Name)
+}
+
+// LineEntry says that the instructions from Offset up to the next entry were
+// compiled from source at Line and Column
+type LineEntry struct {
+	Offset int
+	Line int
+	Column int
+}
+
+// LineTable maps instruction offsets back to the source, entries are sorted by offset
+type LineTable []LineEntry
+
+// Lookup finds the entry covering the instruction at offset
+func (lt LineTable) Lookup(offset int) (LineEntry,bool) {
+	i:=sort.Search(len(lt),func(i int) bool { return lt[i].Offset>offset })
+	if i==0 {
+		return LineEntry{},false
+	}
+	return lt[i-1],true
+}
@@ -0,0 +1,978 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+// limits imposed by the operand widths in code
+const (
+	maxConstants=1<<16
+	maxGlobals=1<<16
+	maxLocals=1<<8
+	maxArgs=1<<8-1
+	maxFree=1<<8-1
+	maxBuiltins=1<<8 // object.RegisterBuiltin can add more, the ones past this cannot be called from compiled code
+	maxElements=1<<16-1
+	maxJump=1<<16-1 // the furthest offset a jump can go to, which bounds the length of a scope with jumps
+)
+
+// the output of the compiler and the input of the vm. Lines and Source are
+// debug information, the vm runs fine without them
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants []object.Object
+	Lines code.LineTable
+	Source string // the file the program was compiled from
+	Globals []string // the names of the globals by slot, those of earlier compilations included
+}
+
+type EmittedInstruction struct {
+	Opcode code.Opcode
+	Position int
+}
+
+// every function body is compiled in a scope of its own, the outermost scope is the program
+type CompilationScope struct {
+	instructions code.Instructions
+	lines code.LineTable
+	lastInstruction EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops []*loopJumps // the loops being compiled, innermost last
+}
+
+// the jumps break and continue emitted in a loop body, they are patched once
+// the loop has been compiled and their targets are known
+type loopJumps struct {
+	breaks []int
+	continues []int
+}
+
+type Compiler struct {
+	constants []object.Object
+	symbolTable *SymbolTable
+
+	scopes []CompilationScope
+	scopeIndex int
+
+	pos token.Position // where the node being compiled starts, recorded in the line table
+	source string
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(),[]object.Object{})
+}
+
+// NewWithState continues from the globals and constants of an earlier
+// compilation, which is what a repl needs to keep its bindings between lines
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants: constants,
+		symbolTable: s,
+		scopes: []CompilationScope{{}},
+	}
+}
+
+// the symbol table of the outermost scope, to hand to NewWithState
+func (c *Compiler) SymbolTable() *SymbolTable {
+	s:=c.symbolTable
+	for s.Outer!=nil {
+		s=s.Outer
+	}
+	return s
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants: c.constants,
+		Lines: c.scopes[c.scopeIndex].lines,
+		Source: c.source,
+		Globals: c.SymbolTable().slotNames(),
+	}
+}
+
+// Compile lowers node and everything below it into the current scope. The
+// first error stops compilation, it carries the position of the offending node
+func (c *Compiler) Compile(node ast.Node) error {
+	if node!=nil {
+		defer c.at(node)()
+	}
+
+	switch node:=node.(type) {
+
+	// statements
+	case *ast.Program:
+		if c.source=="" {
+			c.source=node.Pos().File
+		}
+		for _,s:=range node.Statements {
+			if err:=c.Compile(s);err!=nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStmt:
+		if err:=c.Compile(node.Expression);err!=nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStmt:
+		for _,s:=range node.Statements {
+			if err:=c.Compile(s);err!=nil {
+				return err
+			}
+		}
+	case *ast.LetStmt:
+		return c.compileLet(node)
+	case *ast.ReturnStmt:
+		if err:=c.Compile(node.ReturnValue);err!=nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.WhileStmt:
+		return c.compileWhile(node)
+	case *ast.ForStmt:
+		return c.compileFor(node)
+	case *ast.ForInStmt:
+		return c.compileForIn(node)
+	case *ast.BranchStmt:
+		return c.compileBranch(node)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return c.emitConstant(node,&object.Integer{Value: node.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(node,&object.String{Value: node.Value})
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err:=c.Compile(node.Right);err!=nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
+		default:
+			return c.errorf(node,"unknown operator %s",node.Operator)
+		}
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+	case *ast.LogicalExpression:
+		return c.compileLogical(node)
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+	case *ast.IfExpression:
+		return c.compileIf(node)
+	case *ast.Identifier:
+		return c.compileIdentifier(node)
+	case *ast.Function:
+		return c.compileFunction(node,"")
+	case *ast.CallExpr:
+		if len(node.Arguments)>maxArgs {
+			return c.errorf(node,"too many arguments, at most %d are allowed",maxArgs)
+		}
+		if err:=c.Compile(node.Function);err!=nil {
+			return err
+		}
+		for _,a:=range node.Arguments {
+			if err:=c.Compile(a);err!=nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall,len(node.Arguments))
+	case *ast.ArrayLiteral:
+		if len(node.Elements)>maxElements {
+			return c.errorf(node,"array literal too long, at most %d elements are allowed",maxElements)
+		}
+		for _,e:=range node.Elements {
+			if err:=c.Compile(e);err!=nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray,len(node.Elements))
+	case *ast.HashLiteral:
+		if 2*len(node.Pairs)>maxElements {
+			return c.errorf(node,"hash literal too long, at most %d pairs are allowed",maxElements/2)
+		}
+		// keys and values stay in source order, the vm pairs them back up
+		for _,pair:=range node.Pairs {
+			if err:=c.Compile(pair.Key);err!=nil {
+				return err
+			}
+			if err:=c.Compile(pair.Value);err!=nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash,2*len(node.Pairs))
+	case *ast.IndexExpression:
+		if err:=c.Compile(node.Left);err!=nil {
+			return err
+		}
+		if err:=c.Compile(node.Index);err!=nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.BadExpr,*ast.BadStmt:
+		return c.errorf(node,"cannot compile code with syntax errors")
+	default:
+		// a missing expression, like the value of a bare return, is null
+		if node==nil {
+			c.emit(code.OpNull)
+			return nil
+		}
+		return c.errorf(node,"cannot compile node of type %T",node)
+	}
+	return nil
+}
+
+// the value is compiled before the name is defined, so let x = x + 1 still sees
+// the outer x. A function literal gets the name so that it can call itself, and
+// the name is defined first in case the body assigns to it
+func (c *Compiler) compileLet(node *ast.LetStmt) error {
+	fn,ok:=node.Value.(*ast.Function)
+	if !ok {
+		if err:=c.Compile(node.Value);err!=nil {
+			return err
+		}
+	}
+
+	sym,err:=c.define(node.Name)
+	if err!=nil {
+		return err
+	}
+	if ok {
+		restore:=c.at(fn)
+		err:=c.compileFunction(fn,node.Name.Value)
+		restore()
+		if err!=nil {
+			return err
+		}
+	}
+	c.setSymbol(sym)
+	return nil
+}
+
+func (c *Compiler) define(ident *ast.Identifier) (Symbol,error) {
+	limit:=maxGlobals
+	if c.symbolTable.Outer!=nil {
+		limit=maxLocals
+	}
+	if !c.symbolTable.isOwn(ident.Value) && c.symbolTable.NumDefinitions()>=limit {
+		return Symbol{},c.errorf(ident,"too many variables in one scope, at most %d are allowed",limit)
+	}
+	return c.symbolTable.Define(ident.Value),nil
+}
+
+func (c *Compiler) setSymbol(sym Symbol) {
+	switch {
+	case sym.Scope==GlobalScope:
+		c.emit(code.OpSetGlobal,sym.Index)
+	case sym.Scope==FreeScope:
+		c.emit(code.OpSetFreeCell,sym.Index)
+	case sym.Cell:
+		c.emit(code.OpSetLocalCell,sym.Index)
+	default:
+		c.emit(code.OpSetLocal,sym.Index)
+	}
+}
+
+func (c *Compiler) compileIdentifier(node *ast.Identifier) error {
+	sym,ok:=c.symbolTable.Resolve(node.Value)
+	if !ok {
+		return c.errorf(node,"undefined variable %s",node.Value)
+	}
+	if sym.Scope==BuiltinScope && sym.Index>=maxBuiltins {
+		return c.errorf(node,"builtin %s cannot be compiled, only the first %d builtins registered can",node.Value,maxBuiltins)
+	}
+	c.loadSymbol(sym)
+	return nil
+}
+
+func (c *Compiler) loadSymbol(sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal,sym.Index)
+	case LocalScope:
+		if sym.Cell {
+			c.emit(code.OpGetLocalCell,sym.Index)
+		} else {
+			c.emit(code.OpGetLocal,sym.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin,sym.Index)
+	case FreeScope:
+		if sym.Cell {
+			c.emit(code.OpGetFreeCell,sym.Index)
+		} else {
+			c.emit(code.OpGetFree,sym.Index)
+		}
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// both operands are always evaluated left to right, which is why < has an opcode of its own
+// instead of being > with the operands swapped
+func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
+	if err:=c.Compile(node.LeftExpr);err!=nil {
+		return err
+	}
+	if err:=c.Compile(node.RightExpr);err!=nil {
+		return err
+	}
+	return c.emitOperator(node,node.Operator)
+}
+
+// the opcode of a binary operator, the operands are already on the stack
+func (c *Compiler) emitOperator(node ast.Node, operator string) error {
+	switch operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case "<":
+		c.emit(code.OpLessThan)
+	case ">=":
+		c.emit(code.OpGreaterEqual)
+	case "<=":
+		c.emit(code.OpLessEqual)
+	case "%":
+		c.emit(code.OpMod)
+	case "**":
+		c.emit(code.OpPow)
+	case "&":
+		c.emit(code.OpBitAnd)
+	case "|":
+		c.emit(code.OpBitOr)
+	case "^":
+		c.emit(code.OpBitXor)
+	case "<<":
+		c.emit(code.OpShiftLeft)
+	case ">>":
+		c.emit(code.OpShiftRight)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	default:
+		return c.errorf(node,"unknown operator %s",operator)
+	}
+	return nil
+}
+
+// an assignment leaves the value assigned on the stack. x op= v loads x before
+// v is evaluated, a[i] op= v evaluates a and i once and indexes with copies of them
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	operator:=strings.TrimSuffix(node.Operator,"=")
+
+	switch target:=node.Target.(type) {
+	case *ast.Identifier:
+		sym,ok:=c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return c.errorf(target,"undefined variable %s",target.Value)
+		}
+		if sym.Scope==BuiltinScope {
+			return c.errorf(target,"cannot assign to builtin %s",target.Value)
+		}
+		if operator!="" {
+			c.loadSymbol(sym)
+		}
+		if err:=c.Compile(node.Value);err!=nil {
+			return err
+		}
+		if operator!="" {
+			if err:=c.emitOperator(node,operator);err!=nil {
+				return err
+			}
+		}
+		c.setSymbol(sym)
+		c.loadSymbol(sym)
+
+	case *ast.IndexExpression:
+		if err:=c.Compile(target.Left);err!=nil {
+			return err
+		}
+		if err:=c.Compile(target.Index);err!=nil {
+			return err
+		}
+		if operator!="" {
+			c.emit(code.OpDupPair)
+			c.emit(code.OpIndex)
+		}
+		if err:=c.Compile(node.Value);err!=nil {
+			return err
+		}
+		if operator!="" {
+			if err:=c.emitOperator(node,operator);err!=nil {
+				return err
+			}
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return c.errorf(node,"cannot assign to %s",node.Target.String())
+	}
+	return nil
+}
+
+// the right operand is jumped over when the left one decides the result, and
+// two OpBang turn whatever it gives into a boolean the way the evaluator does
+//
+//	a && b:  a  JumpNotTruthy F  b  Bang Bang  Jump End  F: False  End:
+//	a || b:  a  JumpNotTruthy R  True  Jump End  R: b  Bang Bang  End:
+func (c *Compiler) compileLogical(node *ast.LogicalExpression) error {
+	if node.Operator!="&&" && node.Operator!="||" {
+		return c.errorf(node,"unknown operator %s",node.Operator)
+	}
+	if err:=c.Compile(node.Left);err!=nil {
+		return err
+	}
+	jumpNotTruthyPos:=c.emit(code.OpJumpNotTruthy,9999)
+
+	if node.Operator=="||" {
+		c.emit(code.OpTrue)
+		jumpPos:=c.emit(code.OpJump,9999)
+		c.changeOperand(jumpNotTruthyPos,len(c.currentInstructions()))
+		if err:=c.compileTruthiness(node.Right);err!=nil {
+			return err
+		}
+		c.changeOperand(jumpPos,len(c.currentInstructions()))
+		return c.checkJumps(node)
+	}
+
+	if err:=c.compileTruthiness(node.Right);err!=nil {
+		return err
+	}
+	jumpPos:=c.emit(code.OpJump,9999)
+	c.changeOperand(jumpNotTruthyPos,len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos,len(c.currentInstructions()))
+	return c.checkJumps(node)
+}
+
+// node as a boolean
+func (c *Compiler) compileTruthiness(node ast.Expression) error {
+	if err:=c.Compile(node);err!=nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+// loops leave nothing on the stack, and the parser only lets break and continue
+// be statements of the body or of an if statement in it, so nothing is on the
+// stack when they jump either
+//
+//	while (c) { b }:  Start: c  JumpNotTruthy End  b  Jump Start  End:
+func (c *Compiler) compileWhile(node *ast.WhileStmt) error {
+	start:=len(c.currentInstructions())
+	if err:=c.Compile(node.Condition);err!=nil {
+		return err
+	}
+	jumpNotTruthyPos:=c.emit(code.OpJumpNotTruthy,9999)
+
+	loop,err:=c.compileLoopBody(node.Body)
+	if err!=nil {
+		return err
+	}
+	c.patchJumps(loop.continues,start)
+	c.emit(code.OpJump,start)
+
+	end:=len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos,end)
+	c.patchJumps(loop.breaks,end)
+	return c.checkJumps(node)
+}
+
+//	for (i; c; p) { b }:  i  Start: c  JumpNotTruthy End  b  Continue: p  Jump Start  End:
+func (c *Compiler) compileFor(node *ast.ForStmt) error {
+	if node.Init!=nil {
+		if err:=c.Compile(node.Init);err!=nil {
+			return err
+		}
+	}
+
+	start:=len(c.currentInstructions())
+	jumpNotTruthyPos:=-1
+	if node.Condition!=nil {
+		if err:=c.Compile(node.Condition);err!=nil {
+			return err
+		}
+		jumpNotTruthyPos=c.emit(code.OpJumpNotTruthy,9999)
+	}
+
+	loop,err:=c.compileLoopBody(node.Body)
+	if err!=nil {
+		return err
+	}
+	c.patchJumps(loop.continues,len(c.currentInstructions()))
+	if node.Post!=nil {
+		if err:=c.Compile(node.Post);err!=nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump,start)
+
+	end:=len(c.currentInstructions())
+	if jumpNotTruthyPos>=0 {
+		c.changeOperand(jumpNotTruthyPos,end)
+	}
+	c.patchJumps(loop.breaks,end)
+	return c.checkJumps(node)
+}
+
+// the items and the index are kept in variables the program cannot name, so
+// that nothing of the loop stays on the stack while the body runs. Nested loops
+// get variables of their own, loops one after the other share them
+//
+//	items = Iterate(xs)  i = 0
+//	Start: i < len(items)  JumpNotTruthy End  x = items[i]  b
+//	Continue: i = i + 1  Jump Start  End:
+func (c *Compiler) compileForIn(node *ast.ForInStmt) error {
+	if err:=c.Compile(node.Iterable);err!=nil {
+		return err
+	}
+	c.emit(code.OpIterate)
+
+	depth:=len(c.scopes[c.scopeIndex].loops)
+	items,err:=c.define(c.hidden(node,fmt.Sprintf("@items%d",depth)))
+	if err!=nil {
+		return err
+	}
+	c.setSymbol(items)
+	index,err:=c.define(c.hidden(node,fmt.Sprintf("@index%d",depth)))
+	if err!=nil {
+		return err
+	}
+	if err:=c.emitConstant(node,&object.Integer{Value: 0});err!=nil {
+		return err
+	}
+	c.setSymbol(index)
+
+	start:=len(c.currentInstructions())
+	c.loadSymbol(index)
+	c.emit(code.OpGetBuiltin,builtinIndex("len"))
+	c.loadSymbol(items)
+	c.emit(code.OpCall,1)
+	c.emit(code.OpLessThan)
+	jumpNotTruthyPos:=c.emit(code.OpJumpNotTruthy,9999)
+
+	c.loadSymbol(items)
+	c.loadSymbol(index)
+	c.emit(code.OpIndex)
+	variable,err:=c.define(node.Variable)
+	if err!=nil {
+		return err
+	}
+	c.setSymbol(variable)
+
+	loop,err:=c.compileLoopBody(node.Body)
+	if err!=nil {
+		return err
+	}
+	c.patchJumps(loop.continues,len(c.currentInstructions()))
+	c.loadSymbol(index)
+	if err:=c.emitConstant(node,&object.Integer{Value: 1});err!=nil {
+		return err
+	}
+	c.emit(code.OpAdd)
+	c.setSymbol(index)
+	c.emit(code.OpJump,start)
+
+	end:=len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos,end)
+	c.patchJumps(loop.breaks,end)
+	return c.checkJumps(node)
+}
+
+// an identifier no source can contain, for variables only the compiler uses
+func (c *Compiler) hidden(node ast.Node, name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENTIFIER,Value: name,Pos: node.Pos()},Value: name}
+}
+
+func builtinIndex(name string) int {
+	for i,b:=range object.Builtins() {
+		if b.Name==name {
+			return i
+		}
+	}
+	panic("no builtin "+name)
+}
+
+func (c *Compiler) compileLoopBody(body *ast.BlockStmt) (*loopJumps,error) {
+	scope:=&c.scopes[c.scopeIndex]
+	loop:=&loopJumps{}
+	scope.loops = append(scope.loops, loop)
+	err:=c.Compile(body)
+	scope=&c.scopes[c.scopeIndex]
+	scope.loops=scope.loops[:len(scope.loops)-1]
+	return loop,err
+}
+
+// break and continue jump to targets that are only known once the loop is done
+func (c *Compiler) compileBranch(node *ast.BranchStmt) error {
+	loops:=c.scopes[c.scopeIndex].loops
+	if len(loops)==0 {
+		return c.errorf(node,"%s outside of a loop",node.Token.Value)
+	}
+	loop:=loops[len(loops)-1]
+	pos:=c.emit(code.OpJump,9999)
+	if node.Token.Value=="break" {
+		loop.breaks = append(loop.breaks, pos)
+	} else {
+		loop.continues = append(loop.continues, pos)
+	}
+	return nil
+}
+
+// every jump a construct emits has been patched by the time it is done and goes
+// no further than the end of the scope so far, which makes checking the length
+// enough to know none of the targets was truncated
+func (c *Compiler) checkJumps(node ast.Node) error {
+	if len(c.currentInstructions())>maxJump {
+		return c.errorf(node,"too much code to jump over, at most %d bytes of instructions are allowed",maxJump)
+	}
+	return nil
+}
+
+func (c *Compiler) patchJumps(positions []int, target int) {
+	for _,pos:=range positions {
+		c.changeOperand(pos,target)
+	}
+}
+
+// the jumps are emitted with a placeholder target that is patched once the
+// code they jump over has been emitted
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err:=c.Compile(node.Condition);err!=nil {
+		return err
+	}
+
+	jumpNotTruthyPos:=c.emit(code.OpJumpNotTruthy,9999)
+	if err:=c.compileBlockValue(node.Consequence);err!=nil {
+		return err
+	}
+	jumpPos:=c.emit(code.OpJump,9999)
+	c.changeOperand(jumpNotTruthyPos,len(c.currentInstructions()))
+
+	if node.Alternative==nil {
+		c.emit(code.OpNull)
+	} else if err:=c.compileBlockValue(node.Alternative);err!=nil {
+		return err
+	}
+	c.changeOperand(jumpPos,len(c.currentInstructions()))
+	return c.checkJumps(node)
+}
+
+// a block used as a value leaves exactly one value on the stack: that of its last
+// expression statement, or null if it ends in anything else
+func (c *Compiler) compileBlockValue(block *ast.BlockStmt) error {
+	start:=len(c.currentInstructions())
+	if err:=c.Compile(block);err!=nil {
+		return err
+	}
+	if len(c.currentInstructions())>start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// name is what the function is bound to by a let, empty for an anonymous literal.
+// The values of the free variables are pushed right before OpClosure, in the
+// order the body first used them
+func (c *Compiler) compileFunction(node *ast.Function, name string) error {
+	if len(node.Params)>maxArgs {
+		return c.errorf(node,"too many parameters, at most %d are allowed",maxArgs)
+	}
+
+	assigned,rebound,nested:=scanFunction(node)
+	cells:=map[string]bool{}
+	for name:=range nested {
+		if assigned[name] || rebound[name] {
+			cells[name]=true
+		}
+	}
+
+	c.enterScope()
+	c.symbolTable.cells=cells
+	// a function assigning to its own name changes the variable it is bound to,
+	// which then has to be found the usual way
+	if name!="" && !assigned[name] {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _,p:=range node.Params {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err:=c.Compile(node.Body);err!=nil {
+		return err
+	}
+	// the value of the last expression is returned implicitly
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols:=c.symbolTable.FreeSymbols
+	numLocals:=c.symbolTable.NumDefinitions()
+	cellSlots:=c.symbolTable.cellSlots()
+	localNames:=c.symbolTable.slotNames()
+	lines:=c.scopes[c.scopeIndex].lines
+	instructions:=c.leaveScope()
+
+	if len(freeSymbols)>maxFree {
+		return c.errorf(node,"function uses too many variables of enclosing functions, at most %d are allowed",maxFree)
+	}
+	freeNames:=make([]string,len(freeSymbols))
+	for i,sym:=range freeSymbols {
+		c.captureSymbol(sym)
+		freeNames[i]=sym.Name
+	}
+
+	compiled:=&object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals: numLocals,
+		NumParameters: len(node.Params),
+		Cells: cellSlots,
+		Lines: lines,
+		LocalNames: localNames,
+		FreeNames: freeNames,
+	}
+	index,err:=c.addConstant(node,compiled)
+	if err!=nil {
+		return err
+	}
+	c.emit(code.OpClosure,index,len(freeSymbols))
+	return nil
+}
+
+// a cell is captured as the cell itself, so that the closure shares the variable
+// instead of getting a copy of its value
+func (c *Compiler) captureSymbol(sym Symbol) {
+	switch {
+	case sym.Cell && sym.Scope==LocalScope:
+		c.emit(code.OpGetLocal,sym.Index)
+	case sym.Cell && sym.Scope==FreeScope:
+		c.emit(code.OpGetFree,sym.Index)
+	default:
+		c.loadSymbol(sym)
+	}
+}
+
+// scanFunction finds the names assigned to anywhere in fn, nested functions
+// included, the names fn may bind more than once and the names used by the
+// functions nested in it. A local that is used by a nested function and assigned
+// or bound again has to be a cell. A let binds more than once when there are
+// other bindings of its name, or when it is not a statement of the body itself
+// and so may run once per iteration or not at all. A for-in variable always does.
+// Names are matched without regard to scope, which can make a cell of a variable
+// that did not need one but never misses one
+func scanFunction(fn *ast.Function) (assigned,rebound,nested map[string]bool) {
+	assigned=map[string]bool{}
+	rebound=map[string]bool{}
+	nested=map[string]bool{}
+
+	bindings:=map[string]int{}
+	for _,p:=range fn.Params {
+		bindings[p.Value]++
+	}
+	once:=map[*ast.LetStmt]bool{}
+	for _,stmt:=range fn.Body.Statements {
+		if let,ok:=stmt.(*ast.LetStmt);ok {
+			once[let]=true
+		}
+	}
+
+	depth:=0
+	var visit func(ast.Node) bool
+	visit=func(node ast.Node) bool {
+		switch node:=node.(type) {
+		case *ast.AssignExpression:
+			if ident,ok:=node.Target.(*ast.Identifier);ok {
+				assigned[ident.Value]=true
+			}
+		case *ast.LetStmt:
+			if depth==0 {
+				bindings[node.Name.Value]++
+				if !once[node] {
+					rebound[node.Name.Value]=true
+				}
+			}
+		case *ast.ForInStmt:
+			if depth==0 {
+				rebound[node.Variable.Value]=true
+			}
+		case *ast.Identifier:
+			if depth>0 {
+				nested[node.Value]=true
+			}
+		case *ast.Function:
+			depth++
+			ast.Inspect(node.Body,visit)
+			depth--
+			return false
+		}
+		return true
+	}
+	ast.Inspect(fn.Body,visit)
+	for name,n:=range bindings {
+		if n>1 {
+			rebound[name]=true
+		}
+	}
+	return assigned,rebound,nested
+}
+
+func (c *Compiler) emitConstant(node ast.Node, obj object.Object) error {
+	index,err:=c.addConstant(node,obj)
+	if err!=nil {
+		return err
+	}
+	c.emit(code.OpConstant,index)
+	return nil
+}
+
+func (c *Compiler) addConstant(node ast.Node, obj object.Object) (int,error) {
+	if len(c.constants)>=maxConstants {
+		return 0,c.errorf(node,"too many constants, at most %d are allowed",maxConstants)
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants)-1,nil
+}
+
+// emit appends an instruction to the current scope and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins:=code.Make(op,operands...)
+	pos:=c.addInstruction(ins)
+	c.setLastInstruction(op,pos)
+	c.addLine(pos)
+	return pos
+}
+
+// a new line table entry is only needed when the source position changes
+func (c *Compiler) addLine(offset int) {
+	if !c.pos.IsValid() {
+		return
+	}
+	scope:=&c.scopes[c.scopeIndex]
+	if n:=len(scope.lines);n>0 && scope.lines[n-1].Line==c.pos.Line && scope.lines[n-1].Column==c.pos.Column {
+		return
+	}
+	scope.lines = append(scope.lines, code.LineEntry{Offset: offset,Line: c.pos.Line,Column: c.pos.Column})
+}
+
+// points the line table at node until the returned function is called
+func (c *Compiler) at(node ast.Node) func() {
+	outer:=c.pos
+	c.pos=sourcePos(node)
+	return func() { c.pos=outer }
+}
+
+// operations are attributed to their operator rather than to where their left operand starts
+func sourcePos(node ast.Node) token.Position {
+	switch node:=node.(type) {
+	case *ast.InfixExpression:
+		return node.Token.Pos
+	case *ast.LogicalExpression:
+		return node.Token.Pos
+	case *ast.AssignExpression:
+		return node.Token.Pos
+	case *ast.CallExpr:
+		return node.Token.Pos
+	case *ast.IndexExpression:
+		return node.Token.Pos
+	}
+	return node.Pos()
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction:=len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	scope:=&c.scopes[c.scopeIndex]
+	scope.previousInstruction=scope.lastInstruction
+	scope.lastInstruction=EmittedInstruction{Opcode: op,Position: pos}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions())==0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode==op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope:=&c.scopes[c.scopeIndex]
+	scope.instructions=scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction=scope.previousInstruction
+	for n:=len(scope.lines);n>0 && scope.lines[n-1].Offset>=len(scope.instructions);n-- {
+		scope.lines=scope.lines[:n-1]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos:=c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos,code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode=code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins:=c.currentInstructions()
+	copy(ins[pos:],newInstruction)
+}
+
+// only valid for an instruction of the same opcode, the width stays the same
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op:=code.Opcode(c.currentInstructions()[opPos])
+	c.replaceInstruction(opPos,code.Make(op,operand))
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable=NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions:=c.currentInstructions()
+	c.scopes=c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable=c.symbolTable.Outer
+	return instructions
+}
+
+func (c *Compiler) errorf(node ast.Node, format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %s",node.Pos(),fmt.Sprintf(format,a...))
+}
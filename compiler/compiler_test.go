@@ -0,0 +1,843 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/parser"
+)
+
+// expectedConstants holds int64-able ints, strings, or the instructions of a compiled function
+type compilerTestCase struct {
+	input string
+	expectedConstants []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func parse(input string) *ast.Program {
+	l:=lexer.New(input)
+	p:=parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _,tt:=range tests {
+		program:=parse(tt.input)
+
+		compiler:=New()
+		if err:=compiler.Compile(program);err!=nil {
+			t.Fatalf("Compiler error for %q: %s",tt.input,err)
+		}
+
+		bytecode:=compiler.Bytecode()
+		testInstructions(t,tt.input,tt.expectedInstructions,bytecode.Instructions)
+		testConstants(t,tt.input,tt.expectedConstants,bytecode.Constants)
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out:=code.Instructions{}
+	for _,ins:=range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+	concatted:=concatInstructions(expected)
+	if concatted.String()!=actual.String() {
+		t.Errorf("Wrong instructions for %q\nexpected:\n%sgot:\n%s",input,concatted,actual)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+	if len(expected)!=len(actual) {
+		t.Errorf("Wrong number of constants for %q, expected %d got %d",input,len(expected),len(actual))
+		return
+	}
+
+	for i,constant:=range expected {
+		switch constant:=constant.(type) {
+		case int:
+			integer,ok:=actual[i].(*object.Integer)
+			if !ok || integer.Value!=int64(constant) {
+				t.Errorf("Constant %d for %q, expected %d got %+v",i,input,constant,actual[i])
+			}
+		case string:
+			str,ok:=actual[i].(*object.String)
+			if !ok || str.Value!=constant {
+				t.Errorf("Constant %d for %q, expected %q got %+v",i,input,constant,actual[i])
+			}
+		case []code.Instructions:
+			fn,ok:=actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("Constant %d for %q, expected a CompiledFunction got %T",i,input,actual[i])
+				continue
+			}
+			testInstructions(t,input,constant,fn.Instructions)
+		}
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "1 + 2",
+			expectedConstants: []interface{}{1,2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "1; 2",
+			expectedConstants: []interface{}{1,2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "2 * 3 - 4 / 1",
+			expectedConstants: []interface{}{2,3,4,1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpMul),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpConstant,3),
+				code.Make(code.OpDiv),
+				code.Make(code.OpSub),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "~1 % 2 ** 3",
+			expectedConstants: []interface{}{1,2,3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpPow),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "1 & 2 | 3 ^ 4 << 5 >> 6",
+			expectedConstants: []interface{}{1,2,3,4,5,6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpBitAnd),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpConstant,3),
+				code.Make(code.OpConstant,4),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant,5),
+				code.Make(code.OpShiftRight),
+				code.Make(code.OpBitXor),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// operands keep their source order, < is not a swapped >
+			input: "1 < 2",
+			expectedConstants: []interface{}{1,2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "true != false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpFalse),
+				code.Make(code.OpNotEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10,3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),            // 0000
+				code.Make(code.OpJumpNotTruthy,10), // 0001
+				code.Make(code.OpConstant,0),      // 0004
+				code.Make(code.OpJump,11),          // 0007
+				code.Make(code.OpNull),            // 0010
+				code.Make(code.OpPop),             // 0011
+				code.Make(code.OpConstant,1),      // 0012
+				code.Make(code.OpPop),             // 0015
+			},
+		},
+		{
+			input: "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10,20,3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),            // 0000
+				code.Make(code.OpJumpNotTruthy,10), // 0001
+				code.Make(code.OpConstant,0),      // 0004
+				code.Make(code.OpJump,13),          // 0007
+				code.Make(code.OpConstant,1),      // 0010
+				code.Make(code.OpPop),             // 0013
+				code.Make(code.OpConstant,2),      // 0014
+				code.Make(code.OpPop),             // 0017
+			},
+		},
+		{
+			// a block that does not end in an expression is null
+			input: "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),            // 0000
+				code.Make(code.OpJumpNotTruthy,14), // 0001
+				code.Make(code.OpConstant,0),      // 0004
+				code.Make(code.OpSetGlobal,0),     // 0007
+				code.Make(code.OpNull),            // 0010
+				code.Make(code.OpJump,15),          // 0011
+				code.Make(code.OpNull),            // 0014
+				code.Make(code.OpPop),             // 0015
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy,10), // 0001
+				code.Make(code.OpFalse),            // 0004
+				code.Make(code.OpBang),             // 0005
+				code.Make(code.OpBang),             // 0006
+				code.Make(code.OpJump,11),          // 0007
+				code.Make(code.OpFalse),            // 0010
+				code.Make(code.OpPop),              // 0011
+			},
+		},
+		{
+			input: "false || true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),           // 0000
+				code.Make(code.OpJumpNotTruthy,8), // 0001
+				code.Make(code.OpTrue),            // 0004
+				code.Make(code.OpJump,11),         // 0005
+				code.Make(code.OpTrue),            // 0008
+				code.Make(code.OpBang),            // 0009
+				code.Make(code.OpBang),            // 0010
+				code.Make(code.OpPop),             // 0011
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "let i = 0; while (i < 3) { let i = i + 1; }",
+			expectedConstants: []interface{}{0,3,1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),       // 0000
+				code.Make(code.OpSetGlobal,0),      // 0003
+				code.Make(code.OpGetGlobal,0),      // 0006
+				code.Make(code.OpConstant,1),       // 0009
+				code.Make(code.OpLessThan),         // 0012
+				code.Make(code.OpJumpNotTruthy,29), // 0013
+				code.Make(code.OpGetGlobal,0),      // 0016
+				code.Make(code.OpConstant,2),       // 0019
+				code.Make(code.OpAdd),              // 0022
+				code.Make(code.OpSetGlobal,0),      // 0023
+				code.Make(code.OpJump,6),           // 0026
+			},
+		},
+		{
+			// continue goes to the end of the body, break past the loop
+			input: "for (;;) { if (true) { continue } break }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy,11), // 0001
+				code.Make(code.OpJump,16),          // 0004
+				code.Make(code.OpNull),             // 0007
+				code.Make(code.OpJump,12),          // 0008
+				code.Make(code.OpNull),             // 0011
+				code.Make(code.OpPop),              // 0012
+				code.Make(code.OpJump,19),          // 0013
+				code.Make(code.OpJump,0),           // 0016
+			},
+		},
+		{
+			// the items and the index live in globals of their own
+			input: "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1,0,1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),       // 0000
+				code.Make(code.OpArray,1),          // 0003
+				code.Make(code.OpIterate),          // 0006
+				code.Make(code.OpSetGlobal,0),      // 0007
+				code.Make(code.OpConstant,1),       // 0010
+				code.Make(code.OpSetGlobal,1),      // 0013
+				code.Make(code.OpGetGlobal,1),      // 0016
+				code.Make(code.OpGetBuiltin,0),     // 0019
+				code.Make(code.OpGetGlobal,0),      // 0021
+				code.Make(code.OpCall,1),           // 0024
+				code.Make(code.OpLessThan),         // 0026
+				code.Make(code.OpJumpNotTruthy,57), // 0027
+				code.Make(code.OpGetGlobal,0),      // 0030
+				code.Make(code.OpGetGlobal,1),      // 0033
+				code.Make(code.OpIndex),            // 0036
+				code.Make(code.OpSetGlobal,2),      // 0037
+				code.Make(code.OpGetGlobal,2),      // 0040
+				code.Make(code.OpPop),              // 0043
+				code.Make(code.OpGetGlobal,1),      // 0044
+				code.Make(code.OpConstant,2),       // 0047
+				code.Make(code.OpAdd),              // 0050
+				code.Make(code.OpSetGlobal,1),      // 0051
+				code.Make(code.OpJump,16),          // 0054
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "let x = 1; x = 2;",
+			expectedConstants: []interface{}{1,2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),  // 0000
+				code.Make(code.OpSetGlobal,0), // 0003
+				code.Make(code.OpConstant,1),  // 0006
+				code.Make(code.OpSetGlobal,0), // 0009
+				code.Make(code.OpGetGlobal,0), // 0012
+				code.Make(code.OpPop),         // 0015
+			},
+		},
+		{
+			input: "let a = [1]; a[0] += 2;",
+			expectedConstants: []interface{}{1,0,2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),  // 0000
+				code.Make(code.OpArray,1),     // 0003
+				code.Make(code.OpSetGlobal,0), // 0006
+				code.Make(code.OpGetGlobal,0), // 0009
+				code.Make(code.OpConstant,1),  // 0012
+				code.Make(code.OpDupPair),     // 0015
+				code.Make(code.OpIndex),       // 0016
+				code.Make(code.OpConstant,2),  // 0017
+				code.Make(code.OpAdd),         // 0020
+				code.Make(code.OpSetIndex),    // 0021
+				code.Make(code.OpPop),         // 0022
+			},
+		},
+		{
+			// n is assigned by the closure, so both refer to it through a cell
+			input: "fn() { let n = 0; fn() { n += 1 } }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell,0),
+					code.Make(code.OpConstant,1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFreeCell,0),
+					code.Make(code.OpGetFreeCell,0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant,0),
+					code.Make(code.OpSetLocalCell,0),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpClosure,2,1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,3,0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+
+	bc:=compileBytecode(t,"fn(a, b) { let c = 1; fn() { a = c; b } }")
+	outer:=bc.Constants[2].(*object.CompiledFunction)
+	if len(outer.Cells)!=1 || outer.Cells[0]!=0 {
+		t.Errorf("Expected only a to be a cell, got cells %v",outer.Cells)
+	}
+
+	// bound more than once, or maybe not at all, is as good as assigned
+	bc=compileBytecode(t,"fn(a, e) { let b = 1; let e = 2; for (c in [a]) { let d = c; fn() { a; b; c; d; e } } }")
+	outer=bc.Constants[len(bc.Constants)-1].(*object.CompiledFunction)
+	var cells []string
+	for _,slot:=range outer.Cells {
+		cells = append(cells, outer.LocalNames[slot])
+	}
+	if strings.Join(cells," ")!="e c d" {
+		t.Errorf("Expected e, c and d to be cells, got %v",cells)
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "let one = 1; let two = one; two;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpSetGlobal,0),
+				code.Make(code.OpGetGlobal,0),
+				code.Make(code.OpSetGlobal,1),
+				code.Make(code.OpGetGlobal,1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// rebinding reuses the slot
+			input: "let a = 1; let a = a + 1;",
+			expectedConstants: []interface{}{1,1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpSetGlobal,0),
+				code.Make(code.OpGetGlobal,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal,0),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestStringArrayHashIndex(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon","key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "[1, 2][0]",
+			expectedConstants: []interface{}{1,2,0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpArray,2),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "{1: 2, 3: 4}",
+			expectedConstants: []interface{}{1,2,3,4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpConstant,3),
+				code.Make(code.OpHash,4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash,0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,10,
+				[]code.Instructions{
+					code.Make(code.OpConstant,0),
+					code.Make(code.OpConstant,1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,2,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the last expression is returned implicitly
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,2,
+				[]code.Instructions{
+					code.Make(code.OpConstant,0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant,1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,2,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,0,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn(a, b) { let c = a; c + b }; f(1, 2);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpSetLocal,2),
+					code.Make(code.OpGetLocal,2),
+					code.Make(code.OpGetLocal,1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				1,2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,0,0),
+				code.Make(code.OpSetGlobal,0),
+				code.Make(code.OpGetGlobal,0),
+				code.Make(code.OpConstant,1),
+				code.Make(code.OpConstant,2),
+				code.Make(code.OpCall,2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a function refers to itself through the running closure
+			input: "let f = fn() { f() };",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall,0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,0,0),
+				code.Make(code.OpSetGlobal,0),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests:=[]compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree,0),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpClosure,0,1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,1,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a is passed down through the middle function, which captures it as well
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree,0),
+					code.Make(code.OpGetFree,1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree,0),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpClosure,0,2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpClosure,1,1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,2,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// globals are not captured, they are looked up when used
+			input: "let g = 1; fn() { g }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal,0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpSetGlobal,0),
+				code.Make(code.OpClosure,1,0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a local function calls itself without capturing its own slot
+			input: "fn() { let loop = fn(x) { loop(x) }; loop(1) }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpCall,1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure,0,0),
+					code.Make(code.OpSetLocal,0),
+					code.Make(code.OpGetLocal,0),
+					code.Make(code.OpConstant,1),
+					code.Make(code.OpCall,1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure,2,0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	lenIndex:=-1
+	for i,b:=range object.Builtins() {
+		if b.Name=="len" {
+			lenIndex=i
+		}
+	}
+
+	tests:=[]compilerTestCase{
+		{
+			input: "len([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin,lenIndex),
+				code.Make(code.OpArray,0),
+				code.Make(code.OpCall,1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a binding shadows the builtin
+			input: "let len = 1; len",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant,0),
+				code.Make(code.OpSetGlobal,0),
+				code.Make(code.OpGetGlobal,0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t,tests)
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected string
+	}{
+		{"x","1:1: undefined variable x"},
+		{"let a = 1;\nfoo(a)","2:1: undefined variable foo"},
+		{"fn() { fn() { a } }","1:15: undefined variable a"},
+		{"x = 1","1:1: undefined variable x"},
+		{"len += 1","1:1: cannot assign to builtin len"},
+	}
+
+	for _,tt:=range tests {
+		err:=New().Compile(parse(tt.input))
+		if err==nil {
+			t.Errorf("Expected an error for %q",tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(),tt.expected) {
+			t.Errorf("Wrong error for %q, expected %q got %q",tt.input,tt.expected,err.Error())
+		}
+	}
+}
+
+// jump targets are two bytes wide, a jump past them is an error rather than a
+// truncated target. The 1s are the same constant, so only the code grows
+func TestCompilerJumpLimit(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected string
+	}{
+		{strings.Repeat("1;",20000)+`if (false) { puts("wrong") } else { puts("right") }`,"1:40001: too much code to jump over"},
+		{"let f = fn() { "+strings.Repeat("1;",20000)+"while (true) { break } }","1:40016: too much code to jump over"},
+		{strings.Repeat("1;",20000)+"true && false","1:40001: too much code to jump over"},
+	}
+
+	for _,tt:=range tests {
+		err:=New().Compile(parse(tt.input))
+		if err==nil || !strings.Contains(err.Error(),tt.expected) {
+			t.Errorf("Expected %q for %d bytes of source got %v",tt.expected,len(tt.input),err)
+		}
+	}
+
+	if err:=New().Compile(parse(strings.Repeat("1;",10000)+"if (false) { 1 } else { 2 }"));err!=nil {
+		t.Errorf("Expected code below the limit to compile, got %s",err)
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global:=NewSymbolTable()
+	a:=global.Define("a")
+	b:=global.Define("b")
+	if a!=(Symbol{Name: "a",Scope: GlobalScope,Index: 0}) || b!=(Symbol{Name: "b",Scope: GlobalScope,Index: 1}) {
+		t.Errorf("Wrong global symbols, got %+v and %+v",a,b)
+	}
+	if again:=global.Define("a");again!=a {
+		t.Errorf("Expected redefining a to reuse %+v got %+v",a,again)
+	}
+
+	local:=NewEnclosedSymbolTable(global)
+	c:=local.Define("c")
+	if c!=(Symbol{Name: "c",Scope: LocalScope,Index: 0}) {
+		t.Errorf("Wrong local symbol, got %+v",c)
+	}
+
+	inner:=NewEnclosedSymbolTable(local)
+	inner.DefineFunctionName("f")
+	d:=inner.Define("d")
+
+	tests:=[]struct{
+		table *SymbolTable
+		name string
+		expected Symbol
+	}{
+		{local,"a",a},
+		{local,"c",c},
+		{local,"len",Symbol{Name: "len",Scope: BuiltinScope,Index: 0}},
+		{inner,"a",a},
+		{inner,"c",Symbol{Name: "c",Scope: FreeScope,Index: 0}},
+		{inner,"d",d},
+		{inner,"f",Symbol{Name: "f",Scope: FunctionScope,Index: 0}},
+	}
+	for _,tt:=range tests {
+		sym,ok:=tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("Name %s not resolvable",tt.name)
+			continue
+		}
+		if sym!=tt.expected {
+			t.Errorf("Expected %s to resolve to %+v got %+v",tt.name,tt.expected,sym)
+		}
+	}
+
+	if _,ok:=global.Resolve("c");ok {
+		t.Errorf("Expected c not to be visible in the global scope")
+	}
+	if len(inner.FreeSymbols)!=1 || inner.FreeSymbols[0]!=c {
+		t.Errorf("Expected c to be the only free symbol got %+v",inner.FreeSymbols)
+	}
+}
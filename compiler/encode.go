@@ -0,0 +1,586 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+// The .mkc format, all counts and lengths are uvarints:
+//
+//	magic      "MKC\x00"
+//	version    uint16, big endian
+//	flags      one byte, flagDebug if line tables and the source name follow
+//	source     string, only with flagDebug
+//	builtins   count, then the name of every builtin an OpGetBuiltin operand may refer to
+//	globals    count, then the name of every global slot
+//	constants  count, then each constant as a tag byte and its payload
+//	main       instructions, then a line table with flagDebug
+//
+// strings are a length followed by the bytes, instructions likewise. An integer
+// constant is a zigzag varint, a function is its locals, its parameters, the
+// count and slots of its cells, the names of its locals and then of its free
+// variables each as a count and the strings, its instructions and with flagDebug
+// its line table. A line table is a count followed by offset, line and column of
+// every entry.
+const (
+	Magic="MKC\x00"
+	FormatVersion=6 // 2 added closures, 3 the comparison, modulo, power and bitwise operators, 4 loops, 5 assignment, 6 variable names
+)
+
+const flagDebug=1<<0
+
+const (
+	tagInteger='I'
+	tagString='S'
+	tagFunction='F'
+)
+
+var (
+	ErrNotBytecode=errors.New("not a compiled monkey file")
+	ErrVersion=errors.New("unsupported format version")
+	ErrTruncated=errors.New("truncated file")
+	ErrCorrupt=errors.New("corrupt file")
+)
+
+// IsBytecode reports whether data starts like a compiled file, to tell it from source
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data,[]byte(Magic))
+}
+
+// MarshalBinary encodes b in the .mkc format. Line tables are written when
+// b.Lines is not nil, StripDebug drops them
+func (b *Bytecode) MarshalBinary() ([]byte,error) {
+	e:=&encoder{debug: b.Lines!=nil}
+
+	e.buf.WriteString(Magic)
+	e.buf.Write(binary.BigEndian.AppendUint16(nil,FormatVersion))
+	if e.debug {
+		e.buf.WriteByte(flagDebug)
+		e.string(b.Source)
+	} else {
+		e.buf.WriteByte(0)
+	}
+
+	// builtin operands are indexes into object.Builtins(), which may be ordered
+	// differently where the file is loaded, so the names go along
+	builtins:=object.Builtins()
+	e.uvarint(uint64(len(builtins)))
+	for _,builtin:=range builtins {
+		e.string(builtin.Name)
+	}
+	e.names(b.Globals)
+
+	e.uvarint(uint64(len(b.Constants)))
+	for i,constant:=range b.Constants {
+		if err:=e.constant(constant);err!=nil {
+			return nil,fmt.Errorf("constant %d: %w",i,err)
+		}
+	}
+
+	e.bytes(b.Instructions)
+	e.lines(b.Lines)
+	return e.buf.Bytes(),nil
+}
+
+// UnmarshalBinary decodes a .mkc file into b. Everything is checked before it is
+// accepted: instructions that would make the vm read past the constants, the
+// builtins, the globals, the locals or free variables of their function or the
+// instructions themselves are rejected, and so are cell instructions on a local
+// that is not a cell and code that takes more off the stack than it put there.
+// Whether a free variable holds a cell depends on the closure the function ends
+// up in, the vm checks that when it runs
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsBytecode(data) {
+		return ErrNotBytecode
+	}
+	d:=&decoder{data: data,off: len(Magic)}
+
+	version:=d.uint16()
+	if d.err==nil && version!=FormatVersion {
+		return fmt.Errorf("%w: the file is version %d, this monkey reads version %d",ErrVersion,version,FormatVersion)
+	}
+	flags:=d.byte()
+	if d.err==nil && flags&^flagDebug!=0 {
+		return fmt.Errorf("%w: unknown flags %#x",ErrCorrupt,flags)
+	}
+	d.debug=flags&flagDebug!=0
+
+	var source string
+	if d.debug {
+		source=d.string()
+	}
+
+	builtins:=make([]int,d.count())
+	for i:=range builtins {
+		name:=d.string()
+		if d.err!=nil {
+			break
+		}
+		builtins[i]=-1
+		for j,builtin:=range object.Builtins() {
+			if builtin.Name==name {
+				builtins[i]=j
+			}
+		}
+		if builtins[i]<0 {
+			return fmt.Errorf("%w: the program uses builtin `%s`, which is not available",ErrCorrupt,name)
+		}
+	}
+	globals:=d.names()
+
+	constants:=make([]object.Object,d.count())
+	for i:=range constants {
+		constants[i]=d.constant()
+	}
+
+	instructions:=d.instructions()
+	lines:=d.lines()
+
+	if d.err!=nil {
+		return d.err
+	}
+	if d.off!=len(d.data) {
+		return fmt.Errorf("%w: %d bytes of trailing data",ErrCorrupt,len(d.data)-d.off)
+	}
+
+	// only now that the sizes are known can the operands be checked
+	for i,constant:=range constants {
+		if fn,ok:=constant.(*object.CompiledFunction);ok {
+			if err:=relocate(fn,false,constants,builtins,len(globals));err!=nil {
+				return fmt.Errorf("function in constant %d: %w",i,err)
+			}
+		}
+	}
+	if err:=relocate(&object.CompiledFunction{Instructions: instructions},true,constants,builtins,len(globals));err!=nil {
+		return err
+	}
+
+	*b=Bytecode{Instructions: instructions,Constants: constants,Lines: lines,Source: source,Globals: globals}
+	return nil
+}
+
+// StripDebug drops the line tables and the source name, of the functions in the pool too
+func (b *Bytecode) StripDebug() {
+	b.Lines=nil
+	b.Source=""
+	for _,constant:=range b.Constants {
+		if fn,ok:=constant.(*object.CompiledFunction);ok {
+			fn.Lines=nil
+		}
+	}
+}
+
+// relocate checks every instruction of fn and rewrites builtin operands from the
+// indexes in the file to the indexes of this process. The main program is
+// passed as a function without locals or free variables
+func relocate(fn *object.CompiledFunction, main bool, constants []object.Object, builtins []int, numGlobals int) error {
+	ins:=fn.Instructions
+	cells:=map[int]bool{}
+	for _,slot:=range fn.Cells {
+		cells[slot]=true
+	}
+
+	starts:=map[int]bool{}
+	for i:=0;i<len(ins); {
+		starts[i]=true
+		def,err:=code.Lookup(ins[i])
+		if err!=nil {
+			return fmt.Errorf("%w: %s at offset %d",ErrCorrupt,err,i)
+		}
+		width:=0
+		for _,w:=range def.OperandWidths {
+			width+=w
+		}
+		if i+1+width>len(ins) {
+			return fmt.Errorf("%w: %s at offset %d is cut short",ErrCorrupt,def.Name,i)
+		}
+
+		operands,_:=code.ReadOperands(def,ins[i+1:])
+		switch op:=code.Opcode(ins[i]);op {
+		case code.OpConstant:
+			if operands[0]>=len(constants) {
+				return fmt.Errorf("%w: constant %d at offset %d does not exist",ErrCorrupt,operands[0],i)
+			}
+		case code.OpClosure:
+			if operands[0]>=len(constants) || !object.Is(constants[operands[0]],object.COMPILED_FUNCTION_OBJ) {
+				return fmt.Errorf("%w: constant %d at offset %d is not a function",ErrCorrupt,operands[0],i)
+			}
+			if want:=len(constants[operands[0]].(*object.CompiledFunction).FreeNames);operands[1]!=want {
+				return fmt.Errorf("%w: closure at offset %d over %d values of a function with %d free variables",ErrCorrupt,i,operands[1],want)
+			}
+		case code.OpJump,code.OpJumpNotTruthy:
+			if operands[0]>len(ins) {
+				return fmt.Errorf("%w: jump to %d at offset %d is out of range",ErrCorrupt,operands[0],i)
+			}
+		case code.OpGetBuiltin:
+			if operands[0]>=len(builtins) {
+				return fmt.Errorf("%w: builtin %d at offset %d does not exist",ErrCorrupt,operands[0],i)
+			}
+			if builtins[operands[0]]>=maxBuiltins {
+				return fmt.Errorf("%w: builtin %d at offset %d is number %d here, past the %d an operand can refer to",ErrCorrupt,operands[0],i,builtins[operands[0]],maxBuiltins)
+			}
+			copy(ins[i:],code.Make(code.OpGetBuiltin,builtins[operands[0]]))
+		case code.OpGetGlobal,code.OpSetGlobal:
+			if operands[0]>=numGlobals {
+				return fmt.Errorf("%w: global %d at offset %d does not exist",ErrCorrupt,operands[0],i)
+			}
+		case code.OpGetLocal,code.OpSetLocal,code.OpGetLocalCell,code.OpSetLocalCell:
+			if operands[0]>=fn.NumLocals {
+				return fmt.Errorf("%w: local %d at offset %d does not exist",ErrCorrupt,operands[0],i)
+			}
+			// getting a cell itself is how it is captured, anything else has to
+			// go through it or leave it alone
+			isCellOp:=op==code.OpGetLocalCell || op==code.OpSetLocalCell
+			if (isCellOp || op==code.OpSetLocal) && isCellOp!=cells[operands[0]] {
+				return fmt.Errorf("%w: %s at offset %d on local %d, which is %s",ErrCorrupt,def.Name,i,operands[0],cellOrNot(cells[operands[0]]))
+			}
+		case code.OpGetFree,code.OpGetFreeCell,code.OpSetFreeCell:
+			if operands[0]>=len(fn.FreeNames) {
+				return fmt.Errorf("%w: free variable %d at offset %d does not exist",ErrCorrupt,operands[0],i)
+			}
+		case code.OpHash:
+			if operands[0]%2!=0 {
+				return fmt.Errorf("%w: hash of %d elements at offset %d, keys and values come in pairs",ErrCorrupt,operands[0],i)
+			}
+		case code.OpReturn:
+			if main {
+				return fmt.Errorf("%w: OpReturn at offset %d outside of a function",ErrCorrupt,i)
+			}
+		}
+		i+=1+width
+	}
+	return checkStack(ins,starts)
+}
+
+func cellOrNot(cell bool) string {
+	if cell {
+		return "a cell"
+	}
+	return "not a cell"
+}
+
+// checkStack follows every path through ins from the start. No instruction may
+// take more values off the stack than the path to it left there, paths that
+// meet have to agree on how many that is, and jumps have to land on an
+// instruction or at the very end
+func checkStack(ins code.Instructions, starts map[int]bool) error {
+	depths:=map[int]int{0: 0}
+	pending:=[]int{0}
+	reach:=func(from,to,depth int) error {
+		if to==len(ins) {
+			return nil
+		}
+		if !starts[to] {
+			return fmt.Errorf("%w: jump at offset %d into the middle of an instruction",ErrCorrupt,from)
+		}
+		if known,ok:=depths[to];ok {
+			if known!=depth {
+				return fmt.Errorf("%w: offset %d is reached with %d and with %d values on the stack",ErrCorrupt,to,known,depth)
+			}
+			return nil
+		}
+		depths[to]=depth
+		pending = append(pending, to)
+		return nil
+	}
+
+	for len(pending)>0 && len(ins)>0 {
+		i:=pending[len(pending)-1]
+		pending=pending[:len(pending)-1]
+
+		def,_:=code.Lookup(ins[i])
+		operands,width:=code.ReadOperands(def,ins[i+1:])
+		op:=code.Opcode(ins[i])
+		pops,pushes,ok:=stackEffect(op,operands)
+		if !ok {
+			return fmt.Errorf("%w: %s at offset %d cannot be checked",ErrCorrupt,def.Name,i)
+		}
+		if depths[i]<pops {
+			return fmt.Errorf("%w: %s at offset %d takes %d values off a stack of %d",ErrCorrupt,def.Name,i,pops,depths[i])
+		}
+		depth:=depths[i]-pops+pushes
+
+		switch op {
+		case code.OpReturn,code.OpReturnValue:
+			continue
+		case code.OpJump:
+			if err:=reach(i,operands[0],depth);err!=nil {
+				return err
+			}
+			continue
+		case code.OpJumpNotTruthy:
+			if err:=reach(i,operands[0],depth);err!=nil {
+				return err
+			}
+		}
+		if err:=reach(i,i+1+width,depth);err!=nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// how many values op takes off the stack and how many it puts back, an opcode
+// missing here is rejected rather than guessed at
+func stackEffect(op code.Opcode, operands []int) (pops,pushes int, ok bool) {
+	switch op {
+	case code.OpConstant,code.OpTrue,code.OpFalse,code.OpNull,code.OpGetGlobal,code.OpGetLocal,
+		code.OpGetBuiltin,code.OpGetFree,code.OpGetLocalCell,code.OpGetFreeCell,code.OpCurrentClosure:
+		return 0,1,true
+	case code.OpPop,code.OpJumpNotTruthy,code.OpSetGlobal,code.OpSetLocal,code.OpSetLocalCell,code.OpSetFreeCell,code.OpReturnValue:
+		return 1,0,true
+	case code.OpMinus,code.OpBang,code.OpBitNot,code.OpIterate:
+		return 1,1,true
+	case code.OpAdd,code.OpSub,code.OpMul,code.OpDiv,code.OpMod,code.OpPow,
+		code.OpEqual,code.OpNotEqual,code.OpGreaterThan,code.OpLessThan,code.OpLessEqual,code.OpGreaterEqual,
+		code.OpBitAnd,code.OpBitOr,code.OpBitXor,code.OpShiftLeft,code.OpShiftRight,code.OpIndex:
+		return 2,1,true
+	case code.OpSetIndex:
+		return 3,1,true
+	case code.OpDupPair:
+		return 2,4,true
+	case code.OpArray,code.OpHash:
+		return operands[0],1,true
+	case code.OpCall:
+		return operands[0]+1,1,true
+	case code.OpClosure:
+		return operands[1],1,true
+	case code.OpJump,code.OpReturn:
+		return 0,0,true
+	}
+	return 0,0,false
+}
+
+type encoder struct {
+	buf bytes.Buffer
+	debug bool
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil,v))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) names(names []string) {
+	e.uvarint(uint64(len(names)))
+	for _,name:=range names {
+		e.string(name)
+	}
+}
+
+func (e *encoder) lines(lt code.LineTable) {
+	if !e.debug {
+		return
+	}
+	e.uvarint(uint64(len(lt)))
+	for _,entry:=range lt {
+		e.uvarint(uint64(entry.Offset))
+		e.uvarint(uint64(entry.Line))
+		e.uvarint(uint64(entry.Column))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj:=obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.buf.Write(binary.AppendVarint(nil,obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.uvarint(uint64(obj.NumLocals))
+		e.uvarint(uint64(obj.NumParameters))
+		e.uvarint(uint64(len(obj.Cells)))
+		for _,slot:=range obj.Cells {
+			e.uvarint(uint64(slot))
+		}
+		e.names(obj.LocalNames)
+		e.names(obj.FreeNames)
+		e.bytes(obj.Instructions)
+		e.lines(obj.Lines)
+	default:
+		return fmt.Errorf("cannot encode a %s constant",object.TypeOf(obj))
+	}
+	return nil
+}
+
+// the decoder remembers the first error and returns zero values from then on,
+// so callers only check d.err once they are done
+type decoder struct {
+	data []byte
+	off int
+	debug bool
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err==nil {
+		d.err=fmt.Errorf(format,a...)
+	}
+}
+
+func (d *decoder) truncated(what string) {
+	d.fail("%w: %s at offset %d",ErrTruncated,what,d.off)
+}
+
+func (d *decoder) byte() byte {
+	if d.err!=nil {
+		return 0
+	}
+	if d.off>=len(d.data) {
+		d.truncated("expected a byte")
+		return 0
+	}
+	b:=d.data[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err!=nil {
+		return 0
+	}
+	if d.off+2>len(d.data) {
+		d.truncated("expected the version")
+		return 0
+	}
+	v:=binary.BigEndian.Uint16(d.data[d.off:])
+	d.off+=2
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err!=nil {
+		return 0
+	}
+	v,n:=binary.Uvarint(d.data[d.off:])
+	if n<=0 {
+		d.truncated("expected a number")
+		return 0
+	}
+	d.off+=n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err!=nil {
+		return 0
+	}
+	v,n:=binary.Varint(d.data[d.off:])
+	if n<=0 {
+		d.truncated("expected a number")
+		return 0
+	}
+	d.off+=n
+	return v
+}
+
+// a length or count, which cannot be larger than what is left of the file
+func (d *decoder) count() int {
+	n:=d.uvarint()
+	if n>uint64(len(d.data)-d.off) {
+		d.truncated(fmt.Sprintf("expected %d more entries",n))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) raw() []byte {
+	n:=d.count()
+	if d.err!=nil {
+		return nil
+	}
+	b:=make([]byte,n)
+	copy(b,d.data[d.off:])
+	d.off+=n
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.raw())
+}
+
+func (d *decoder) instructions() code.Instructions {
+	return code.Instructions(d.raw())
+}
+
+func (d *decoder) names() []string {
+	names:=make([]string,d.count())
+	for i:=range names {
+		names[i]=d.string()
+	}
+	return names
+}
+
+func (d *decoder) lines() code.LineTable {
+	if !d.debug {
+		return nil
+	}
+	lt:=make(code.LineTable,d.count())
+	for i:=range lt {
+		lt[i]=code.LineEntry{Offset: int(d.uvarint()),Line: int(d.uvarint()),Column: int(d.uvarint())}
+	}
+	return lt
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag:=d.byte();tag {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		fn:=&object.CompiledFunction{
+			NumLocals: int(d.uvarint()),
+			NumParameters: int(d.uvarint()),
+		}
+		if n:=d.uvarint();n>maxLocals {
+			d.fail("%w: function with %d cells",ErrCorrupt,n)
+		} else if n>0 {
+			fn.Cells=make([]int,n)
+			for i:=range fn.Cells {
+				fn.Cells[i]=int(d.uvarint())
+			}
+		}
+		fn.LocalNames=d.names()
+		fn.FreeNames=d.names()
+		fn.Instructions=d.instructions()
+		fn.Lines=d.lines()
+		if d.err==nil && (fn.NumLocals>maxLocals || fn.NumParameters>fn.NumLocals) {
+			d.fail("%w: function with %d locals and %d parameters",ErrCorrupt,fn.NumLocals,fn.NumParameters)
+		}
+		if d.err==nil && len(fn.LocalNames)!=fn.NumLocals {
+			d.fail("%w: function with %d locals and %d local names",ErrCorrupt,fn.NumLocals,len(fn.LocalNames))
+		}
+		if d.err==nil && len(fn.FreeNames)>maxFree {
+			d.fail("%w: function with %d free variables",ErrCorrupt,len(fn.FreeNames))
+		}
+		for _,slot:=range fn.Cells {
+			if slot<0 || slot>=fn.NumLocals {
+				d.fail("%w: cell in slot %d of a function with %d locals",ErrCorrupt,slot,fn.NumLocals)
+			}
+		}
+		return fn
+	default:
+		if d.err==nil {
+			d.fail("%w: unknown constant tag %#x at offset %d",ErrCorrupt,tag,d.off-1)
+		}
+		return nil
+	}
+}
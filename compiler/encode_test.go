@@ -0,0 +1,278 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+func compileBytecode(t *testing.T, input string) *Bytecode {
+	t.Helper()
+	comp:=New()
+	if err:=comp.Compile(parse(input));err!=nil {
+		t.Fatalf("Compiler error for %q: %s",input,err)
+	}
+	return comp.Bytecode()
+}
+
+func roundTrip(t *testing.T, bc *Bytecode) *Bytecode {
+	t.Helper()
+	data,err:=bc.MarshalBinary()
+	if err!=nil {
+		t.Fatalf("MarshalBinary: %s",err)
+	}
+	loaded:=&Bytecode{}
+	if err:=loaded.UnmarshalBinary(data);err!=nil {
+		t.Fatalf("UnmarshalBinary: %s",err)
+	}
+	return loaded
+}
+
+const encodeInput=`let add = fn(a, b) {
+	a + b
+};
+puts(add(-1, 2), "two", [len("x")]);`
+
+func TestEncodeRoundTrip(t *testing.T) {
+	bc:=compileBytecode(t,encodeInput)
+	loaded:=roundTrip(t,bc)
+
+	if !reflect.DeepEqual(bc,loaded) {
+		t.Errorf("Round trip changed the bytecode\nbefore: %+v\nafter: %+v",bc,loaded)
+	}
+	if len(loaded.Lines)==0 {
+		t.Fatalf("Expected a line table")
+	}
+
+	fn:=loaded.Constants[0].(*object.CompiledFunction)
+	entry,ok:=fn.Lines.Lookup(len(fn.Instructions)-1)
+	if !ok || entry.Line!=2 {
+		t.Errorf("Expected the function body to come from line 2 got %+v",entry)
+	}
+}
+
+func TestEncodeCells(t *testing.T) {
+	bc:=compileBytecode(t,"let f = fn(a) { let b = 0; fn() { a += 1; b = a } }; f(1)()")
+	loaded:=roundTrip(t,bc)
+	if !reflect.DeepEqual(bc,loaded) {
+		t.Errorf("Round trip changed the bytecode\nbefore: %+v\nafter: %+v",bc,loaded)
+	}
+}
+
+func TestEncodeStripped(t *testing.T) {
+	bc:=compileBytecode(t,encodeInput)
+	bc.StripDebug()
+	loaded:=roundTrip(t,bc)
+
+	if loaded.Lines!=nil || loaded.Constants[0].(*object.CompiledFunction).Lines!=nil {
+		t.Errorf("Expected no line tables after stripping")
+	}
+	if !bytes.Equal(loaded.Instructions,bc.Instructions) {
+		t.Errorf("Instructions changed, expected\n%sgot\n%s",bc.Instructions,loaded.Instructions)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data,err:=compileBytecode(t,encodeInput).MarshalBinary()
+	if err!=nil {
+		t.Fatal(err)
+	}
+
+	// every proper prefix of a file is rejected, none of them panics
+	for n:=len(Magic);n<len(data);n++ {
+		err:=(&Bytecode{}).UnmarshalBinary(data[:n])
+		if err==nil {
+			t.Fatalf("Expected an error for a file cut at %d of %d bytes",n,len(data))
+		}
+		if !errors.Is(err,ErrTruncated) && !errors.Is(err,ErrCorrupt) {
+			t.Errorf("Expected a truncation error at %d bytes got %q",n,err)
+		}
+	}
+
+	if err:=(&Bytecode{}).UnmarshalBinary([]byte("let x = 1;"));!errors.Is(err,ErrNotBytecode) {
+		t.Errorf("Expected ErrNotBytecode got %v",err)
+	}
+
+	future:=bytes.Clone(data)
+	binary.BigEndian.PutUint16(future[len(Magic):],FormatVersion+1)
+	if err:=(&Bytecode{}).UnmarshalBinary(future);!errors.Is(err,ErrVersion) {
+		t.Errorf("Expected ErrVersion got %v",err)
+	}
+
+	trailing:=append(bytes.Clone(data),0)
+	if err:=(&Bytecode{}).UnmarshalBinary(trailing);!errors.Is(err,ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for trailing data got %v",err)
+	}
+
+	unnamed:=&Bytecode{Constants: []object.Object{&object.CompiledFunction{NumLocals: 1,LocalNames: []string{}}}}
+	data,_=unnamed.MarshalBinary()
+	if err:=(&Bytecode{}).UnmarshalBinary(data);!errors.Is(err,ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a local without a name got %v",err)
+	}
+}
+
+// a function with the given locals, cells and free variables, for files the compiler would not write
+func badFunction(locals int, cells []int, free []string, ins ...code.Instructions) *object.CompiledFunction {
+	return &object.CompiledFunction{
+		Instructions: concatInstructions(ins),
+		NumLocals: locals,
+		Cells: cells,
+		LocalNames: make([]string,locals),
+		FreeNames: free,
+	}
+}
+
+func TestDecodeRejectsBadInstructions(t *testing.T) {
+	closure:=concatInstructions([]code.Instructions{code.Make(code.OpClosure,0,0),code.Make(code.OpPop)})
+	tests:=[]struct{
+		name string
+		bytecode *Bytecode
+		expected string
+	}{
+		{"a missing constant",&Bytecode{Instructions: code.Make(code.OpConstant,3)},"constant 3 at offset 0 does not exist"},
+		{"a closure over an integer",&Bytecode{Instructions: closure,Constants: []object.Object{&object.Integer{Value: 1}}},"is not a function"},
+		{"an unknown opcode",&Bytecode{Instructions: code.Instructions{255}},"opcode 255 undefined"},
+		{"a missing global",&Bytecode{Instructions: code.Make(code.OpGetGlobal,0)},"global 0 at offset 0 does not exist"},
+		{"a local in the main program",&Bytecode{Instructions: code.Make(code.OpGetLocal,0)},"local 0 at offset 0 does not exist"},
+		{
+			"a missing local",
+			&Bytecode{Instructions: closure,Constants: []object.Object{
+				badFunction(1,nil,nil,code.Make(code.OpGetLocal,1),code.Make(code.OpReturnValue)),
+			}},
+			"local 1 at offset 0 does not exist",
+		},
+		{
+			"a cell instruction on a local that is not a cell",
+			&Bytecode{Instructions: closure,Constants: []object.Object{
+				badFunction(1,nil,nil,code.Make(code.OpGetLocalCell,0),code.Make(code.OpReturnValue)),
+			}},
+			"OpGetLocalCell at offset 0 on local 0, which is not a cell",
+		},
+		{
+			"replacing a cell with a value",
+			&Bytecode{Instructions: closure,Constants: []object.Object{
+				badFunction(1,[]int{0},nil,code.Make(code.OpTrue),code.Make(code.OpSetLocal,0),code.Make(code.OpReturn)),
+			}},
+			"OpSetLocal at offset 1 on local 0, which is a cell",
+		},
+		{
+			"a missing free variable",
+			&Bytecode{Instructions: closure,Constants: []object.Object{
+				badFunction(0,nil,[]string{},code.Make(code.OpGetFreeCell,0),code.Make(code.OpReturnValue)),
+			}},
+			"free variable 0 at offset 0 does not exist",
+		},
+		{
+			"a closure without its free values",
+			&Bytecode{Instructions: closure,Constants: []object.Object{
+				badFunction(0,nil,[]string{"a"},code.Make(code.OpGetFree,0),code.Make(code.OpReturnValue)),
+			}},
+			"closure at offset 0 over 0 values of a function with 1 free variables",
+		},
+		{"a hash with a key but no value",&Bytecode{Instructions: concatInstructions([]code.Instructions{code.Make(code.OpNull),code.Make(code.OpHash,1)})},"hash of 1 elements"},
+		{"a return outside of a function",&Bytecode{Instructions: code.Make(code.OpReturn)},"OpReturn at offset 0 outside of a function"},
+		{"popping an empty stack",&Bytecode{Instructions: code.Make(code.OpPop)},"OpPop at offset 0 takes 1 values off a stack of 0"},
+		{
+			"a call without its arguments",
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{code.Make(code.OpNull),code.Make(code.OpCall,1)})},
+			"OpCall at offset 1 takes 2 values off a stack of 1",
+		},
+		{"a jump into an instruction",&Bytecode{Instructions: concatInstructions([]code.Instructions{code.Make(code.OpJump,4),code.Make(code.OpArray,0)})},"jump at offset 0 into the middle of an instruction"},
+		{
+			// only the fallthrough pushes the null
+			"paths that disagree on the stack",
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy,5),   // 0001
+				code.Make(code.OpNull),              // 0004
+				code.Make(code.OpNull),              // 0005
+				code.Make(code.OpPop),               // 0006
+			})},
+			"offset 5 is reached with",
+		},
+	}
+
+	for _,tt:=range tests {
+		data,err:=tt.bytecode.MarshalBinary()
+		if err!=nil {
+			t.Fatalf("%s: %s",tt.name,err)
+		}
+		err=(&Bytecode{}).UnmarshalBinary(data)
+		if !errors.Is(err,ErrCorrupt) || !strings.Contains(err.Error(),tt.expected) {
+			t.Errorf("Expected ErrCorrupt for %s with %q got %v",tt.name,tt.expected,err)
+		}
+	}
+}
+
+// builtin operands are matched up by name, not by where the builtin was registered
+func TestDecodeRelocatesBuiltins(t *testing.T) {
+	bc:=compileBytecode(t,"last([1])")
+	data,err:=bc.MarshalBinary()
+	if err!=nil {
+		t.Fatal(err)
+	}
+
+	// pretend the file was built where last and rest were registered the other way round
+	last:=bytes.Index(data,[]byte("\x04last"))
+	rest:=bytes.Index(data,[]byte("\x04rest"))
+	if last<0 || rest<0 {
+		t.Fatalf("Builtin names not found in the file")
+	}
+	copy(data[last:],"\x04rest")
+	copy(data[rest:],"\x04last")
+
+	loaded:=&Bytecode{}
+	if err:=loaded.UnmarshalBinary(data);err!=nil {
+		t.Fatal(err)
+	}
+
+	restIndex:=-1
+	for i,b:=range object.Builtins() {
+		if b.Name=="rest" {
+			restIndex=i
+		}
+	}
+	expected:=code.Make(code.OpGetBuiltin,restIndex)
+	if !bytes.HasPrefix(loaded.Instructions,expected) {
+		t.Errorf("Expected the builtin operand to be relocated to %d got\n%s",restIndex,loaded.Instructions)
+	}
+}
+
+// builtin operands are one byte wide, builtins registered past the first 256
+// can neither be compiled nor be what a file's builtin refers to here
+func TestBuiltinLimit(t *testing.T) {
+	for i:=len(object.Builtins());i<maxBuiltins+50;i++ {
+		object.RegisterBuiltin(&object.Builtin{Name: fmt.Sprintf("b%03d",i),Fn: func(args ...object.Object) object.Object { return nil }})
+	}
+	beyond:=fmt.Sprintf("b%03d",maxBuiltins+10)
+
+	err:=New().Compile(parse(beyond+"()"))
+	if err==nil || !strings.Contains(err.Error(),"builtin "+beyond+" cannot be compiled") {
+		t.Errorf("Expected an error compiling a call to %s got %v",beyond,err)
+	}
+
+	// a file from where the builtin was registered early enough to be called
+	bc:=compileBytecode(t,"last([1])")
+	data,err:=bc.MarshalBinary()
+	if err!=nil {
+		t.Fatal(err)
+	}
+	last:=bytes.Index(data,[]byte("\x04last"))
+	other:=bytes.Index(data,[]byte("\x04"+beyond))
+	if last<0 || other<0 {
+		t.Fatalf("Builtin names not found in the file")
+	}
+	copy(data[last:],"\x04"+beyond)
+	copy(data[other:],"\x04last")
+
+	if err:=(&Bytecode{}).UnmarshalBinary(data);!errors.Is(err,ErrCorrupt) || !strings.Contains(err.Error(),"past the 256") {
+		t.Errorf("Expected ErrCorrupt for a builtin past the limit got %v",err)
+	}
+}
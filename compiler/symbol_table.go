@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope="GLOBAL"
+	LocalScope SymbolScope="LOCAL"
+	BuiltinScope SymbolScope="BUILTIN"
+	FreeScope SymbolScope="FREE" // a local of an enclosing function, captured by the closure
+	FunctionScope SymbolScope="FUNCTION" // the name a function literal is bound to, inside its own body
+)
+
+// Symbol is what the compiler knows about a name: where it lives and its slot there.
+// A Cell local or free symbol holds an object.Cell with the value in it
+type Symbol struct {
+	Name string
+	Scope SymbolScope
+	Index int
+	Cell bool
+}
+
+// SymbolTable holds the names of one scope. The outermost table is the global
+// scope, every function body gets a table enclosed by the one it is defined in
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// the outer symbols this scope captures, FreeScope symbol i stands for FreeSymbols[i]
+	FreeSymbols []Symbol
+
+	store map[string]Symbol
+	numDefinitions int
+	cells map[string]bool // the locals to define as cells
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s:=NewSymbolTable()
+	s.Outer=outer
+	return s
+}
+
+// Define binds name in this scope. Defining a name twice in the same scope
+// reuses its slot, so a second let overwrites the first like it does in the evaluator
+func (s *SymbolTable) Define(name string) Symbol {
+	if s.isOwn(name) {
+		return s.store[name]
+	}
+
+	sym:=Symbol{Name: name,Index: s.numDefinitions,Scope: GlobalScope}
+	if s.Outer!=nil {
+		sym.Scope=LocalScope
+		sym.Cell=s.cells[name]
+	}
+	s.store[name]=sym
+	s.numDefinitions++
+	return sym
+}
+
+// DefineFunctionName binds the name of the function whose body this scope is,
+// parameters and locals of the same name shadow it
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	sym:=Symbol{Name: name,Index: 0,Scope: FunctionScope}
+	s.store[name]=sym
+	return sym
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	sym:=Symbol{Name: original.Name,Index: len(s.FreeSymbols)-1,Scope: FreeScope,Cell: original.Cell}
+	s.store[original.Name]=sym
+	return sym
+}
+
+// NumDefinitions is the number of slots the scope needs
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Resolve looks name up from the innermost scope outwards. A name bound by an
+// enclosing function becomes a free symbol of every scope in between. Builtins
+// are only found when no scope binds the name, the index is into object.Builtins()
+func (s *SymbolTable) Resolve(name string) (Symbol,bool) {
+	if sym,ok:=s.store[name];ok {
+		return sym,true
+	}
+	if s.Outer!=nil {
+		sym,ok:=s.Outer.Resolve(name)
+		if !ok || sym.Scope==GlobalScope || sym.Scope==BuiltinScope {
+			return sym,ok
+		}
+		return s.defineFree(sym),true
+	}
+
+	for i,b:=range object.Builtins() {
+		if b.Name==name {
+			return Symbol{Name: name,Scope: BuiltinScope,Index: i},true
+		}
+	}
+	return Symbol{},false
+}
+
+// the slots of the locals that are cells, in slot order
+func (s *SymbolTable) cellSlots() []int {
+	var slots []int
+	for _,sym:=range s.store {
+		if sym.Scope==LocalScope && sym.Cell {
+			slots = append(slots, sym.Index)
+		}
+	}
+	sort.Ints(slots)
+	return slots
+}
+
+// the names of the globals or locals of this scope, by slot
+func (s *SymbolTable) slotNames() []string {
+	names:=make([]string,s.numDefinitions)
+	for _,sym:=range s.store {
+		if sym.Scope==GlobalScope || sym.Scope==LocalScope {
+			names[sym.Index]=sym.Name
+		}
+	}
+	return names
+}
+
+// reports whether name is a global or local defined in this very scope, rather
+// than something it refers to
+func (s *SymbolTable) isOwn(name string) bool {
+	sym,ok:=s.store[name]
+	return ok && (sym.Scope==GlobalScope || sym.Scope==LocalScope)
+}
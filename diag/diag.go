@@ -0,0 +1,64 @@
+package diag
+
+import (
+	"fmt"
+
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+type Severity int
+
+const (
+	Error Severity=iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return fmt.Sprintf("severity(%d)",int(s))
+}
+
+// so that diagnostics marshal to {"severity":"error"} rather than a bare number
+func (s Severity) MarshalText() ([]byte,error) {
+	return []byte(s.String()),nil
+}
+
+// the source range [Start, End) a diagnostic points at
+type Span struct {
+	Start token.Position `json:"start"`
+	End token.Position `json:"end"`
+}
+
+// a span covering a whole token
+func TokenSpan(tok token.Token) Span {
+	return Span{Start: tok.Pos,End: tok.End}
+}
+
+// a suggested edit: replace the text in Span with Replacement, an empty span is an insertion
+type Fix struct {
+	Message string `json:"message"`
+	Span Span `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+type Diagnostic struct {
+	Code string `json:"code"` // stable identifier like E0001, safe to match on in tools and tests
+	Severity Severity `json:"severity"`
+	Message string `json:"message"`
+	Span Span `json:"span"`
+	Notes []string `json:"notes,omitempty"`
+	Fix *Fix `json:"fix,omitempty"`
+}
+
+// one line form: file:line:col: error[E0001]: message
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s[%s]: %s",d.Span.Start,d.Severity,d.Code,d.Message)
+}
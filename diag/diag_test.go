@@ -0,0 +1,76 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+func pos(line,column,offset int) token.Position {
+	return token.Position{File: "t.monkey",Line: line,Column: column,Offset: offset}
+}
+
+func TestRender(t *testing.T) {
+	src:="let a = 1;\nlet x = (abc + 2;\n"
+	d:=Diagnostic{
+		Code: "E0001",
+		Severity: Error,
+		Message: "something is wrong",
+		Span: Span{Start: pos(2,10,20),End: pos(2,13,23)},
+		Notes: []string{"a note"},
+		Fix: &Fix{Message: "did you mean this?"},
+	}
+
+	var buf bytes.Buffer
+	Render(&buf,src,d)
+
+	expected:=strings.Join([]string{
+		"error[E0001]: something is wrong",
+		" --> t.monkey:2:10",
+		"  |",
+		"2 | let x = (abc + 2;",
+		"  |          ^^^",
+		"  = note: a note",
+		"  = help: did you mean this?",
+		"",
+	},"\n")
+	if buf.String()!=expected {
+		t.Errorf("Wrong rendering, expected\n%s\ngot\n%s",expected,buf.String())
+	}
+}
+
+func TestRenderKeepsTabsAndPointsPastEndOfLine(t *testing.T) {
+	src:="\tfoo(1"
+	d:=Diagnostic{
+		Code: "E0001",
+		Severity: Error,
+		Message: "unclosed",
+		Span: Span{Start: pos(1,7,6),End: pos(1,7,6)},
+	}
+
+	var buf bytes.Buffer
+	Render(&buf,src,d)
+
+	lines:=strings.Split(buf.String(),"\n")
+	if lines[4]!="  | \t     ^" {
+		t.Errorf("Wrong caret line %q",lines[4])
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	d:=Diagnostic{Code: "E0002",Severity: Warning,Message: "m",Span: Span{Start: pos(1,1,0),End: pos(1,2,1)}}
+	out,err:=json.Marshal(d)
+	if err!=nil {
+		t.Fatalf("json.Marshal failed: %v",err)
+	}
+	if !strings.Contains(string(out),`"severity":"warning"`) || !strings.Contains(string(out),`"code":"E0002"`) {
+		t.Errorf("Unexpected json %s",out)
+	}
+
+	if d.Error()!="t.monkey:1:1: warning[E0002]: m" {
+		t.Errorf("Wrong one line form %q",d.Error())
+	}
+}
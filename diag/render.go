@@ -0,0 +1,119 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Render writes d in a human readable form, quoting the offending line of src
+// with a caret underline:
+//
+//	error[E0001]: expected `)`, got `;`
+//	 --> script.monkey:1:15
+//	  |
+//	1 | let x = (1 + 2;
+//	  |               ^
+//	  = note: the `(` at 1:9 is never closed
+//	  = help: did you mean to insert `)` after `2`?
+//
+// src must be the text the positions in d were computed from
+func Render(w io.Writer, src string, d Diagnostic) {
+	fmt.Fprintf(w,"%s[%s]: %s\n",d.Severity,d.Code,d.Message)
+
+	start:=d.Span.Start
+	if !start.IsValid() {
+		renderFooter(w,"",d)
+		return
+	}
+
+	gutter:=strings.Repeat(" ",len(strconv.Itoa(start.Line)))
+	fmt.Fprintf(w,"%s--> %s\n",gutter,start)
+
+	line,lineStart,ok:=sourceLine(src,start.Line)
+	if ok {
+		fmt.Fprintf(w,"%s |\n",gutter)
+		fmt.Fprintf(w,"%d | %s\n",start.Line,line)
+		fmt.Fprintf(w,"%s | %s%s\n",gutter,caretPadding(line,src,lineStart,start.Offset,start.Column),
+			strings.Repeat("^",underlineWidth(line,src,lineStart,d.Span)))
+	}
+	renderFooter(w,gutter,d)
+}
+
+func RenderAll(w io.Writer, src string, diags []Diagnostic) {
+	for _,d:=range diags {
+		Render(w,src,d)
+	}
+}
+
+func renderFooter(w io.Writer, gutter string, d Diagnostic) {
+	for _,note:=range d.Notes {
+		fmt.Fprintf(w,"%s = note: %s\n",gutter,note)
+	}
+	if d.Fix!=nil {
+		fmt.Fprintf(w,"%s = help: %s\n",gutter,d.Fix.Message)
+	}
+}
+
+// the text of the given 1 based line without its line ending, and the offset it starts at
+func sourceLine(src string, line int) (string,int,bool) {
+	start:=0
+	for i:=1;i<line;i++ {
+		nl:=strings.IndexByte(src[start:],'\n')
+		if nl<0 {
+			return "",0,false
+		}
+		start+=nl+1
+	}
+	text:=src[start:]
+	if nl:=strings.IndexByte(text,'\n');nl>=0 {
+		text=text[:nl]
+	}
+	return strings.TrimSuffix(text,"\r"),start,true
+}
+
+// blanks out everything before the caret but keeps tabs so the caret lines up
+// with the quoted line however wide the terminal renders a tab
+func caretPadding(line,src string, lineStart,offset,column int) string {
+	prefix:=""
+	if offset>=lineStart && offset-lineStart<=len(line) && offset<=len(src) {
+		prefix=line[:offset-lineStart]
+	} else {
+		// the offset does not belong to src, fall back to the column
+		runes:=[]rune(line)
+		n:=column-1
+		if n>len(runes) {
+			n=len(runes)
+		}
+		if n<0 {
+			n=0
+		}
+		prefix=string(runes[:n])
+	}
+
+	var b strings.Builder
+	for _,r:=range prefix {
+		if r=='\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return b.String()
+}
+
+// how many characters of the quoted line the span covers, at least one.
+// Spans running onto later lines are underlined to the end of the first one
+func underlineWidth(line,src string, lineStart int, span Span) int {
+	start,end:=span.Start.Offset,span.End.Offset
+	lineEnd:=lineStart+len(line)
+	if span.End.Line!=span.Start.Line || end>lineEnd {
+		end=lineEnd
+	}
+	if start<lineStart || end<=start || end>len(src) {
+		return 1
+	}
+	return utf8.RuneCountInString(src[start:end])
+}
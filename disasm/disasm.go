@@ -0,0 +1,128 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/compiler"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+// Fprint writes a listing of bc: the constant pool, the main program and then
+// every compiled function in the pool, which is where nested functions end up too
+//
+//	== main (script.monkey) ==
+//	constants:
+//	    0  INTEGER 1
+//	code:
+//	    0000  1:9   OpConstant 0    ; 1
+//	    0003  1:1   OpSetGlobal 0
+func Fprint(w io.Writer, bc *compiler.Bytecode) error {
+	header:="main"
+	if bc.Source!="" {
+		header+=" ("+bc.Source+")"
+	}
+	fmt.Fprintf(w,"== %s ==\n",header)
+
+	if len(bc.Constants)>0 {
+		fmt.Fprintln(w,"constants:")
+		for i,constant:=range bc.Constants {
+			fmt.Fprintf(w,"    %-3d %s %s\n",i,object.TypeOf(constant),describe(constant,i))
+		}
+	}
+	fmt.Fprintln(w,"code:")
+	if err:=Instructions(w,bc.Instructions,bc.Constants,bc.Lines);err!=nil {
+		return err
+	}
+
+	for i,constant:=range bc.Constants {
+		fn,ok:=constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w,"\n== fn#%d (%d params, %d locals) ==\n",i,fn.NumParameters,fn.NumLocals)
+		if err:=Instructions(w,fn.Instructions,bc.Constants,fn.Lines);err!=nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Instructions writes one line per instruction of ins: its offset, the source
+// position it was compiled from when lines is not nil, the opcode and its
+// operands, and what a constant or builtin operand refers to. It stops at the
+// first instruction it cannot decode and returns an error for it
+func Instructions(w io.Writer, ins code.Instructions, constants []object.Object, lines code.LineTable) error {
+	for i:=0;i<len(ins); {
+		def,err:=code.Lookup(ins[i])
+		if err!=nil {
+			return fmt.Errorf("offset %04d: %w",i,err)
+		}
+		width:=0
+		for _,w:=range def.OperandWidths {
+			width+=w
+		}
+		if i+1+width>len(ins) {
+			return fmt.Errorf("offset %04d: %s is missing operands",i,def.Name)
+		}
+		operands,_:=code.ReadOperands(def,ins[i+1:])
+
+		text:=def.Name
+		for _,o:=range operands {
+			text+=" "+strconv.Itoa(o)
+		}
+
+		fmt.Fprintf(w,"    %04d  ",i)
+		if lines!=nil {
+			pos:="-"
+			if entry,ok:=lines.Lookup(i);ok {
+				pos=fmt.Sprintf("%d:%d",entry.Line,entry.Column)
+			}
+			fmt.Fprintf(w,"%-6s",pos)
+		}
+		if comment:=annotate(code.Opcode(ins[i]),operands,constants);comment!="" {
+			fmt.Fprintf(w,"%-20s; %s\n",text,comment)
+		} else {
+			fmt.Fprintln(w,text)
+		}
+		i+=1+width
+	}
+	return nil
+}
+
+// what an operand refers to, when that is not obvious from the number
+func annotate(op code.Opcode, operands []int, constants []object.Object) string {
+	switch op {
+	case code.OpConstant:
+		if operands[0]<len(constants) {
+			return describe(constants[operands[0]],operands[0])
+		}
+		return "missing constant"
+	case code.OpClosure:
+		if operands[0]<len(constants) {
+			return fmt.Sprintf("%s, %d free",describe(constants[operands[0]],operands[0]),operands[1])
+		}
+		return "missing constant"
+	case code.OpGetBuiltin:
+		if builtins:=object.Builtins();operands[0]<len(builtins) {
+			return builtins[operands[0]].Name
+		}
+		return "missing builtin"
+	}
+	return ""
+}
+
+// functions are named by their index in the pool, their code is listed on its own
+func describe(obj object.Object, index int) string {
+	switch obj:=obj.(type) {
+	case *object.String:
+		return strconv.Quote(obj.Value)
+	case *object.CompiledFunction:
+		return fmt.Sprintf("fn#%d",index)
+	case nil:
+		return "nil"
+	}
+	return obj.Inspect()
+}
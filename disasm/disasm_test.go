@@ -0,0 +1,109 @@
+package disasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/compiler"
+	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/parser"
+)
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	p:=parser.New(lexer.NewFile("test.monkey",input))
+	comp:=compiler.New()
+	if err:=comp.Compile(p.ParseProgram());err!=nil {
+		t.Fatalf("Compiler error for %q: %s",input,err)
+	}
+	return comp.Bytecode()
+}
+
+func TestFprint(t *testing.T) {
+	bc:=compile(t,"let add = fn(a, b) {\n  a + b\n};\nadd(1, len(\"x\"))")
+
+	var out bytes.Buffer
+	if err:=Fprint(&out,bc);err!=nil {
+		t.Fatal(err)
+	}
+
+	expected:=`== main (test.monkey) ==
+constants:
+    0   COMPILED_FUNCTION fn#0
+    1   INTEGER 1
+    2   STRING "x"
+code:
+    0000  1:11  OpClosure 0 0       ; fn#0, 0 free
+    0004  1:1   OpSetGlobal 0
+    0007  4:1   OpGetGlobal 0
+    0010  4:5   OpConstant 1        ; 1
+    0013  4:8   OpGetBuiltin 0      ; len
+    0015  4:12  OpConstant 2        ; "x"
+    0018  4:11  OpCall 1
+    0020  4:4   OpCall 2
+    0022  4:1   OpPop
+
+== fn#0 (2 params, 2 locals) ==
+    0000  2:3   OpGetLocal 0
+    0002  2:7   OpGetLocal 1
+    0004  2:5   OpAdd
+    0005  2:3   OpReturnValue
+`
+	if out.String()!=expected {
+		t.Errorf("Wrong listing, expected\n%s\ngot\n%s",expected,out.String())
+	}
+}
+
+func TestFprintClosure(t *testing.T) {
+	bc:=compile(t,"fn(a) { fn() { a } }")
+
+	var out bytes.Buffer
+	if err:=Fprint(&out,bc);err!=nil {
+		t.Fatal(err)
+	}
+	for _,line:=range []string{
+		"OpClosure 1 0       ; fn#1, 0 free",
+		"OpGetLocal 0",
+		"OpClosure 0 1       ; fn#0, 1 free",
+		"OpGetFree 0",
+	} {
+		if !strings.Contains(out.String(),line) {
+			t.Errorf("Expected the listing to contain %q got\n%s",line,out.String())
+		}
+	}
+}
+
+func TestInstructionsWithoutLines(t *testing.T) {
+	ins:=append(code.Make(code.OpConstant,0),code.Make(code.OpPop)...)
+	constants:=[]object.Object{&object.Integer{Value: 7}}
+
+	var out bytes.Buffer
+	if err:=Instructions(&out,ins,constants,nil);err!=nil {
+		t.Fatal(err)
+	}
+	expected:="    0000  OpConstant 0        ; 7\n    0003  OpPop\n"
+	if out.String()!=expected {
+		t.Errorf("Wrong listing, expected %q got %q",expected,out.String())
+	}
+}
+
+func TestInstructionsErrors(t *testing.T) {
+	tests:=[]struct{
+		ins code.Instructions
+		expected string
+	}{
+		{code.Instructions{255},"offset 0000: opcode 255 undefined"},
+		{append(code.Make(code.OpPop),byte(code.OpConstant),0),"offset 0001: OpConstant is missing operands"},
+	}
+
+	for _,tt:=range tests {
+		var out bytes.Buffer
+		err:=Instructions(&out,tt.ins,nil,nil)
+		if err==nil || !strings.Contains(err.Error(),tt.expected) {
+			t.Errorf("Expected error %q got %v",tt.expected,err)
+		}
+	}
+}
@@ -0,0 +1,662 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+// there is only ever one true, one false and one null, so we can compare them by pointer
+var (
+	NULL=object.NULL
+	TRUE=object.TRUE
+	FALSE=object.FALSE
+)
+
+// Eval walks the tree rooted at node and returns the value it evaluates to.
+// Runtime errors are returned as *object.Error values, never as Go panics
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node:=node.(type) {
+
+	// statements
+	case *ast.Program:
+		return evalProgram(node,env)
+	case *ast.ExpressionStmt:
+		return Eval(node.Expression,env)
+	case *ast.BlockStmt:
+		return evalBlock(node,env)
+	case *ast.ReturnStmt:
+		val:=Eval(node.ReturnValue,env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStmt:
+		val:=Eval(node.Value,env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value,val)
+		return nil
+	case *ast.WhileStmt:
+		return evalWhileStmt(node,env)
+	case *ast.ForStmt:
+		return evalForStmt(node,env)
+	case *ast.ForInStmt:
+		return evalForInStmt(node,env)
+	case *ast.BranchStmt:
+		if node.Token.Value=="break" {
+			return object.BREAK
+		}
+		return object.CONTINUE
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToObject(node.Value)
+	case *ast.PrefixExpression:
+		right:=Eval(node.Right,env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator,right)
+	case *ast.InfixExpression:
+		left:=Eval(node.LeftExpr,env)
+		if interrupts(left) {
+			return left
+		}
+		right:=Eval(node.RightExpr,env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator,left,right)
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node,env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node,env)
+	case *ast.IfExpression:
+		return evalIfExpression(node,env)
+	case *ast.Identifier:
+		return evalIdentifier(node,env)
+	case *ast.Function:
+		return &object.Function{Params: node.Params,Body: node.Body,Env: env}
+	case *ast.CallExpr:
+		function:=Eval(node.Function,env)
+		if interrupts(function) {
+			return function
+		}
+		args:=evalExpressions(node.Arguments,env)
+		if len(args)==1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function,args)
+	case *ast.ArrayLiteral:
+		elements:=evalExpressions(node.Elements,env)
+		if len(elements)==1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left:=Eval(node.Left,env)
+		if interrupts(left) {
+			return left
+		}
+		index:=Eval(node.Index,env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left,index)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node,env)
+	}
+
+	if node==nil {
+		return NULL
+	}
+	return newError("cannot evaluate node of type %T",node)
+}
+
+// unlike evalBlock this unwraps the return value, a return at the top level ends the program
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _,stmt:=range program.Statements {
+		result=Eval(stmt,env)
+
+		switch result:=result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+// the return value is passed up still wrapped so that enclosing blocks stop as well,
+// and so are break and continue until they reach their loop. A block that is empty
+// or ends in a statement is null, as it is in the vm, never a Go nil that could end
+// up bound to a name
+func evalBlock(block *ast.BlockStmt, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _,stmt:=range block.Statements {
+		result=Eval(stmt,env)
+
+		switch object.TypeOf(result) {
+		case object.RETURN_VALUE_OBJ,object.ERROR_OBJ,object.BREAK_OBJ,object.CONTINUE_OBJ:
+			return result
+		}
+	}
+	if result==nil {
+		return NULL
+	}
+	return result
+}
+
+// loops are statements, they evaluate to nothing like a let does. The body runs
+// in the enclosing scope, so its lets are still there after the loop
+func evalWhileStmt(ws *ast.WhileStmt, env *object.Environment) object.Object {
+	for {
+		condition:=Eval(ws.Condition,env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+		if result,stop:=evalLoopBody(ws.Body,env);stop {
+			return result
+		}
+	}
+}
+
+// a missing condition is always true, the loop then only ends by break or return
+func evalForStmt(fs *ast.ForStmt, env *object.Environment) object.Object {
+	if fs.Init!=nil {
+		if init:=Eval(fs.Init,env);isError(init) {
+			return init
+		}
+	}
+	for {
+		if fs.Condition!=nil {
+			condition:=Eval(fs.Condition,env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+		if result,stop:=evalLoopBody(fs.Body,env);stop {
+			return result
+		}
+		if fs.Post!=nil {
+			if post:=Eval(fs.Post,env);isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+func evalForInStmt(fs *ast.ForInStmt, env *object.Environment) object.Object {
+	iterable:=Eval(fs.Iterable,env)
+	if isError(iterable) {
+		return iterable
+	}
+	items,ok:=object.Items(iterable)
+	if !ok {
+		return newError("cannot iterate over %s",iterable.Type())
+	}
+	for _,item:=range items {
+		env.Set(fs.Variable.Value,item)
+		if result,stop:=evalLoopBody(fs.Body,env);stop {
+			return result
+		}
+	}
+	return nil
+}
+
+// runs the body once, stop says whether the loop ends here. A break ends it with
+// nothing, a return or an error end it and are passed on
+func evalLoopBody(body *ast.BlockStmt, env *object.Environment) (object.Object,bool) {
+	result:=evalBlock(body,env)
+	switch object.TypeOf(result) {
+	case object.BREAK_OBJ:
+		return nil,true
+	case object.RETURN_VALUE_OBJ,object.ERROR_OBJ:
+		return result,true
+	}
+	return nil,false
+}
+
+func nativeBoolToObject(b bool) *object.Boolean {
+	return object.NativeBoolToObject(b)
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperator(right)
+	case "-":
+		return evalMinusPrefixOperator(right)
+	case "~":
+		if right.Type()!=object.INTEGER_OBJ {
+			return newError("unknown operator: ~%s",right.Type())
+		}
+		return &object.Integer{Value: ^right.(*object.Integer).Value}
+	default:
+		return newError("unknown operator: %s%s",operator,right.Type())
+	}
+}
+
+func evalBangOperator(right object.Object) object.Object {
+	if isTruthy(right) {
+		return FALSE
+	}
+	return TRUE
+}
+
+func evalMinusPrefixOperator(right object.Object) object.Object {
+	if right.Type()!=object.INTEGER_OBJ {
+		return newError("unknown operator: -%s",right.Type())
+	}
+	value:=right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
+}
+
+func evalInfixExpression(operator string, left,right object.Object) object.Object {
+	switch {
+	case left.Type()==object.INTEGER_OBJ && right.Type()==object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator,left,right)
+	case left.Type()==object.STRING_OBJ && right.Type()==object.STRING_OBJ:
+		return evalStringInfixExpression(operator,left,right)
+	case left.Type()!=right.Type():
+		return newError("type mismatch: %s %s %s",left.Type(),operator,right.Type())
+	// booleans and null are singletons so pointer comparison is enough
+	case operator=="==":
+		return nativeBoolToObject(left==right)
+	case operator=="!=":
+		return nativeBoolToObject(left!=right)
+	default:
+		return newError("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left,right object.Object) object.Object {
+	leftVal:=left.(*object.Integer).Value
+	rightVal:=right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal+rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal-rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal*rightVal}
+	case "/":
+		if rightVal==0 {
+			return newError("division by zero: %d / %d",leftVal,rightVal)
+		}
+		return &object.Integer{Value: leftVal/rightVal}
+	case "%": // the result has the sign of leftVal, as in Go
+		if rightVal==0 {
+			return newError("division by zero: %d %% %d",leftVal,rightVal)
+		}
+		return &object.Integer{Value: leftVal%rightVal}
+	case "**":
+		if rightVal<0 {
+			return newError("negative exponent: %d ** %d",leftVal,rightVal)
+		}
+		return &object.Integer{Value: intPow(leftVal,rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal&rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal|rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal^rightVal}
+	case "<<",">>": // shifting by 64 or more gives 0, or -1 for >> of a negative number
+		if rightVal<0 {
+			return newError("negative shift count: %d %s %d",leftVal,operator,rightVal)
+		}
+		if operator=="<<" {
+			return &object.Integer{Value: leftVal<<uint64(rightVal)}
+		}
+		return &object.Integer{Value: leftVal>>uint64(rightVal)}
+	case "<":
+		return nativeBoolToObject(leftVal<rightVal)
+	case ">":
+		return nativeBoolToObject(leftVal>rightVal)
+	case "<=":
+		return nativeBoolToObject(leftVal<=rightVal)
+	case ">=":
+		return nativeBoolToObject(leftVal>=rightVal)
+	case "==":
+		return nativeBoolToObject(leftVal==rightVal)
+	case "!=":
+		return nativeBoolToObject(leftVal!=rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+// by squaring, it wraps around on overflow like + and * do
+func intPow(base,exp int64) int64 {
+	result:=int64(1)
+	for exp>0 {
+		if exp&1==1 {
+			result*=base
+		}
+		base*=base
+		exp>>=1
+	}
+	return result
+}
+
+// strings are not singletons, so unlike booleans they compare by value
+func evalStringInfixExpression(operator string, left,right object.Object) object.Object {
+	leftVal:=left.(*object.String).Value
+	rightVal:=right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal+rightVal}
+	case "==":
+		return nativeBoolToObject(leftVal==rightVal)
+	case "!=":
+		return nativeBoolToObject(leftVal!=rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+// && and || always give a boolean. Their operands can be anything, with the same
+// truthiness as an if condition: null and false are false, every other value is
+// true, 0 and "" included. The right operand is not evaluated at all when the
+// left one decides the result
+func evalLogicalExpression(le *ast.LogicalExpression, env *object.Environment) object.Object {
+	left:=Eval(le.Left,env)
+	if interrupts(left) {
+		return left
+	}
+	switch le.Operator {
+	case "&&":
+		if !isTruthy(left) {
+			return FALSE
+		}
+	case "||":
+		if isTruthy(left) {
+			return TRUE
+		}
+	default:
+		return newError("unknown operator: %s",le.Operator)
+	}
+
+	right:=Eval(le.Right,env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToObject(isTruthy(right))
+}
+
+// an assignment gives the value assigned. x op= v reads x before v is evaluated
+// and stores x op v, the target's operands are evaluated only once
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	operator:=strings.TrimSuffix(ae.Operator,"=")
+
+	switch target:=ae.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if operator!="" {
+			current=evalIdentifier(target,env)
+			if isError(current) {
+				return current
+			}
+		}
+		val:=Eval(ae.Value,env)
+		if isError(val) {
+			return val
+		}
+		if operator!="" {
+			if val=evalInfixExpression(operator,current,val);isError(val) {
+				return val
+			}
+		}
+		if !env.Assign(target.Value,val) {
+			if _,ok:=object.LookupBuiltin(target.Value);ok {
+				return newError("cannot assign to builtin: %s",target.Value)
+			}
+			return newError("identifier not found: %s",target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left:=Eval(target.Left,env)
+		if interrupts(left) {
+			return left
+		}
+		index:=Eval(target.Index,env)
+		if isError(index) {
+			return index
+		}
+		var current object.Object
+		if operator!="" {
+			if current=evalIndexExpression(left,index);isError(current) {
+				return current
+			}
+		}
+		val:=Eval(ae.Value,env)
+		if isError(val) {
+			return val
+		}
+		if operator!="" {
+			if val=evalInfixExpression(operator,current,val);isError(val) {
+				return val
+			}
+		}
+		return evalIndexAssignment(left,index,val)
+	}
+	return newError("cannot assign to %s",ae.Target.String())
+}
+
+// arrays and hashes are changed in place, every binding holding them sees the
+// change. An array element has to exist already, a hash key is added if it does not
+func evalIndexAssignment(left,index,val object.Object) object.Object {
+	switch {
+	case left.Type()==object.ARRAY_OBJ && index.Type()==object.INTEGER_OBJ:
+		elements:=left.(*object.Array).Elements
+		idx:=index.(*object.Integer).Value
+		if idx<0 || idx>=int64(len(elements)) {
+			return newError("index out of range: %d with length %d",idx,len(elements))
+		}
+		elements[idx]=val
+	case left.Type()==object.HASH_OBJ:
+		key,ok:=index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s",index.Type())
+		}
+		left.(*object.Hash).Set(key,val)
+	default:
+		return newError("index assignment not supported: %s[%s]",left.Type(),index.Type())
+	}
+	return val
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition:=Eval(ie.Condition,env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence,env)
+	} else if ie.Alternative!=nil {
+		return Eval(ie.Alternative,env)
+	}
+	return NULL
+}
+
+// the user's bindings come first, builtins are only found if nothing shadows them
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val,ok:=env.Get(node.Value);ok {
+		return val
+	}
+	if builtin,ok:=object.LookupBuiltin(node.Value);ok {
+		return builtin
+	}
+	return newError("identifier not found: %s",node.Value)
+}
+
+func evalIndexExpression(left,index object.Object) object.Object {
+	switch {
+	case left.Type()==object.ARRAY_OBJ && index.Type()==object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left,index)
+	case left.Type()==object.HASH_OBJ:
+		return evalHashIndexExpression(left,index)
+	default:
+		return newError("index operator not supported: %s[%s]",left.Type(),index.Type())
+	}
+}
+
+// indexes start at 0, anything outside 0..len-1 (negative indexes included) is an error rather than null
+func evalArrayIndexExpression(array,index object.Object) object.Object {
+	elements:=array.(*object.Array).Elements
+	idx:=index.(*object.Integer).Value
+
+	if idx<0 || idx>=int64(len(elements)) {
+		return newError("index out of range: %d with length %d",idx,len(elements))
+	}
+	return elements[idx]
+}
+
+// a missing key gives null, a key that cannot be hashed is an error
+func evalHashIndexExpression(hash,index object.Object) object.Object {
+	key,ok:=index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s",index.Type())
+	}
+	value,ok:=hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+// keys and values are evaluated in source order, a repeated key keeps the last value
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash:=object.NewHash()
+
+	for _,pair:=range node.Pairs {
+		key:=Eval(pair.Key,env)
+		if isError(key) {
+			return key
+		}
+		hashKey,ok:=key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s",key.Type())
+		}
+
+		value:=Eval(pair.Value,env)
+		if isError(value) {
+			return value
+		}
+		hash.Set(hashKey,value)
+	}
+	return hash
+}
+
+// evaluates left to right and stops at the first error, which is returned on its own
+func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _,e:=range exprs {
+		evaluated:=Eval(e,env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	if builtin,ok:=fn.(*object.Builtin);ok {
+		if result:=builtin.Call(args...);result!=nil {
+			return result
+		}
+		return NULL
+	}
+
+	function,ok:=fn.(*object.Function)
+	if !ok {
+		return newError("not a function: %s",fn.Type())
+	}
+	if len(args)!=len(function.Params) {
+		return newError("wrong number of arguments: want=%d, got=%d",len(function.Params),len(args))
+	}
+
+	extendedEnv:=extendFunctionEnv(function,args)
+	evaluated:=Eval(function.Body,extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+// the parameters are bound in a new scope enclosed by the function's own environment, not the caller's
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env:=object.NewEnclosedEnvironment(fn.Env)
+
+	for i,param:=range fn.Params {
+		env.Set(param.Value,args[i])
+	}
+	return env
+}
+
+// a return inside the function body must not also return from the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if rv,ok:=obj.(*object.ReturnValue);ok {
+		return rv.Value
+	}
+	if obj==nil {
+		return NULL
+	}
+	return obj
+}
+
+// null and false are falsy, everything else is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format,a...)}
+}
+
+// an if starting a statement can break or continue, which abandons the rest of the
+// expression it is the leftmost operand of just like an error does
+func interrupts(obj object.Object) bool {
+	switch object.TypeOf(obj) {
+	case object.ERROR_OBJ,object.BREAK_OBJ,object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
+func isError(obj object.Object) bool {
+	if obj!=nil {
+		return obj.Type()==object.ERROR_OBJ
+	}
+	return false
+}
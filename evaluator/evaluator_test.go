@@ -0,0 +1,778 @@
+package evaluator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/parser"
+)
+
+func testEval(input string) object.Object {
+	l:=lexer.New(input)
+	p:=parser.New(l)
+	program:=p.ParseProgram()
+	env:=object.NewEnvironment()
+	return Eval(program,env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result,ok:=obj.(*object.Integer)
+	if !ok {
+		t.Errorf("Expected an Integer got %T (%+v)",obj,obj)
+		return false
+	}
+	if result.Value!=expected {
+		t.Errorf("Integer has wrong value, expected %d got %d",expected,result.Value)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result,ok:=obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("Expected a Boolean got %T (%+v)",obj,obj)
+		return false
+	}
+	if result.Value!=expected {
+		t.Errorf("Boolean has wrong value, expected %t got %t",expected,result.Value)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj!=NULL {
+		t.Errorf("Expected NULL got %T (%+v)",obj,obj)
+		return false
+	}
+	return true
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{"5",5},
+		{"10",10},
+		{"-5",-5},
+		{"--5",5},
+		{"5 + 5 + 5 + 5 - 10",10},
+		{"2 * 2 * 2 * 2 * 2",32},
+		{"-50 + 100 + -50",0},
+		{"20 + 2 * -10",0},
+		{"50 / 2 * 2 + 10",60},
+		{"3 * (3 * 3) + 10",37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10",50},
+		{"7 % 3",1},
+		{"-7 % 3",-1},
+		{"7 % -3",1},
+		{"2 ** 10",1024},
+		{"-2 ** 2",-4},
+		{"(-2) ** 3",-8},
+		{"2 ** 3 ** 2",512},
+		{"5 ** 0",1},
+		{"2 ** 64",0},
+		{"6 & 3",2},
+		{"6 | 3",7},
+		{"6 ^ 3",5},
+		{"~5",-6},
+		{"1 << 10",1024},
+		{"-16 >> 2",-4},
+		{"1 << 64",0},
+		{"-1 >> 100",-1},
+		{"1 + 2 << 3",17},
+		{"0xF0 & 0x3C | 1",0x31},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		testIntegerObject(t,evaluated,tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected bool
+	}{
+		{"true",true},
+		{"false",false},
+		{"1 < 2",true},
+		{"1 > 2",false},
+		{"1 <= 1",true},
+		{"2 <= 1",false},
+		{"1 >= 2",false},
+		{"2 >= 2",true},
+		{"1 == 1",true},
+		{"1 != 1",false},
+		{"true == true",true},
+		{"true != false",true},
+		{"(1 < 2) == true",true},
+		{"(1 > 2) == true",false},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		testBooleanObject(t,evaluated,tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected bool
+	}{
+		{"!true",false},
+		{"!false",true},
+		{"!5",false},
+		{"!!true",true},
+		{"!!5",true},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		testBooleanObject(t,evaluated,tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected bool
+	}{
+		{"true && true",true},
+		{"true && false",false},
+		{"false || true",true},
+		{"false || false",false},
+		{"1 < 2 && 2 < 3",true},
+		{"1 > 2 || 2 > 3",false},
+		{"0 && \"\"",true},
+		{"if (false) { 1 } || false",false},
+		{"if (false) { 1 } && true",false},
+		{"[] || false",true},
+		// the right operand is not evaluated when it cannot change the result
+		{"false && missing",false},
+		{"true || 1 + true",true},
+		{"let calls = fn() { x }; false && calls()",false},
+	}
+
+	for _,tt:=range tests {
+		testBooleanObject(t,testEval(tt.input),tt.expected)
+	}
+
+	for _,input:=range []string{"true && missing","false || -true"} {
+		if _,ok:=testEval(input).(*object.Error);!ok {
+			t.Errorf("%q: expected the right operand's error",input)
+		}
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected interface{}
+	}{
+		{"if (true) { 10 }",10},
+		{"if (false) { 10 }",nil},
+		{"if (1) { 10 }",10},
+		{"if (1 < 2) { 10 }",10},
+		{"if (1 > 2) { 10 }",nil},
+		{"if (1 > 2) { 10 } else { 20 }",20},
+		{"if (1 < 2) { 10 } else { 20 }",10},
+		{"if (true) {}",nil},
+		{"if (true) { let y = 1; }",nil},
+		{"if (false) { 10 } else {}",nil},
+		{"let x = if (true) {}; x",nil},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		integer,ok:=tt.expected.(int)
+		if ok {
+			testIntegerObject(t,evaluated,int64(integer))
+		} else {
+			testNullObject(t,evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{"return 10;",10},
+		{"return 10; 9;",10},
+		{"return 2 * 5; 9;",10},
+		{"9; return 2 * 5; 9;",10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+  return 1;
+}`,10},
+		{`
+let f = fn(x) {
+  if (x > 1) {
+    if (x > 2) { return 3; }
+    return 2;
+  }
+  return 1;
+};
+f(5) + f(2) * 10;`,23},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		testIntegerObject(t,evaluated,tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1; } i",5},
+		{"let s = 0; for (let i = 1; i <= 4; let i = i + 1) { let s = s + i; } s",10},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s * 10 + x; } s",123},
+		{"let s = 0; for (k in {1: 10, 2: 20}) { let s = s + k; } s",3},
+		{"let n = 0; for (;;) { let n = n + 1; if (n == 3) { break } } n",3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue } let s = s + x; } s",4},
+		{"let s = 0; let i = 0; while (i < 4) { let i = i + 1; if (i == 2) { continue } else { let s = s + i; } } s",8},
+		// break and continue act on the innermost loop
+		{"let s = 0; for (i in [1, 2]) { for (j in [1, 2, 3]) { if (j == 2) { break } let s = s + i * j; } } s",3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } 0 }; f([1, 5, 7])",5},
+		// the iteration is over the array as it was when the loop started
+		{"let xs = [1, 2]; let n = 0; for (x in xs) { let xs = push(xs, x); let n = n + 1; } n",2},
+		{"let x = 0; for (x in [7, 8]) { } x",8},
+	}
+
+	for _,tt:=range tests {
+		testIntegerObject(t,testEval(tt.input),tt.expected)
+	}
+
+	for _,input:=range []string{"while (true) { break }","for (x in []) { x }"} {
+		if result:=testEval(input);result!=nil {
+			t.Errorf("%q: a loop should evaluate to nothing, got %s",input,result.Inspect())
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x",2},
+		{"let x = 1; x = x + 1",2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x",6},
+		{"let x = 0; let y = 0; x = y = 7; x + y",14},
+		{`let s = "a"; s += "b"; s`,"ab"},
+		{"let a = [1, 2, 3]; a[1] = 20; a[2] *= 10; a",[]int64{1,20,30}},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a[0]",9},
+		{`let h = {"k": 1}; h["k"] += 1; h["n"] = 5; h["k"] + h["n"]`,7},
+		// the nearest binding changes, no new one is made
+		{"let x = 1; let f = fn() { x = 5 }; f(); x",5},
+		{"let x = 1; let f = fn() { let x = 2; x = 3 }; f(); x",1},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",3},
+		{"let f = fn(n) { n += 1; n }; f(1)",2},
+		{"let s = 0; for (let i = 0; i < 4; i += 1) { s += i } s",6},
+		{"const xs = [1, 2]; xs[0] = 5; xs[0] + xs[1]",7},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		switch expected:=tt.expected.(type) {
+		case int:
+			testIntegerObject(t,evaluated,int64(expected))
+		case string:
+			str,ok:=evaluated.(*object.String)
+			if !ok || str.Value!=expected {
+				t.Errorf("%q: expected %q got %v",tt.input,expected,evaluated)
+			}
+		case []int64:
+			arr,ok:=evaluated.(*object.Array)
+			if !ok || len(arr.Elements)!=len(expected) {
+				t.Errorf("%q: expected %v got %v",tt.input,expected,evaluated)
+				continue
+			}
+			for i,e:=range expected {
+				testIntegerObject(t,arr.Elements[i],e)
+			}
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected string
+	}{
+		{"x = 1","identifier not found: x"},
+		{"x += 1","identifier not found: x"},
+		{"len = 1","cannot assign to builtin: len"},
+		{"let x = 1; x += true","type mismatch: INTEGER + BOOLEAN"},
+		{"let a = [1]; a[1] = 2","index out of range: 1 with length 1"},
+		{"let a = [1]; a[-1] = 2","index out of range: -1 with length 1"},
+		{`let s = "ab"; s[0] = "c"`,"index assignment not supported: STRING[INTEGER]"},
+		{"let h = {}; h[fn() {}] = 1","unusable as hash key: FUNCTION"},
+		{"let h = {}; h[1] += 1","type mismatch: NULL + INTEGER"},
+	}
+
+	for _,tt:=range tests {
+		errObj,ok:=testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error",tt.input)
+			continue
+		}
+		if errObj.Message!=tt.expected {
+			t.Errorf("%q: expected %q got %q",tt.input,tt.expected,errObj.Message)
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expectedMessage string
+	}{
+		{"5 + true;","type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;","type mismatch: INTEGER + BOOLEAN"},
+		{"-true","unknown operator: -BOOLEAN"},
+		{"true + false;","unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5","unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }","unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+  return 1;
+}`,"unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar","identifier not found: foobar"},
+		{"10 / 0","division by zero: 10 / 0"},
+		{"10 % 0","division by zero: 10 % 0"},
+		{"2 ** -1","negative exponent: 2 ** -1"},
+		{"1 << -1","negative shift count: 1 << -1"},
+		{"~true","unknown operator: ~BOOLEAN"},
+		{"true & false","unknown operator: BOOLEAN & BOOLEAN"},
+		{`"a" <= "b"`,"unknown operator: STRING <= STRING"},
+		{"5(1)","not a function: INTEGER"},
+		{"fn(x) { x }(1, 2)","wrong number of arguments: want=1, got=2"},
+		{"let x = if (true) {}; x + 1","type mismatch: NULL + INTEGER"},
+		{"let x = if (true) { let y = 1; }; -x","unknown operator: -NULL"},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+
+		errObj,ok:=evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("Expected an error object got %T (%+v)",evaluated,evaluated)
+			continue
+		}
+		if errObj.Message!=tt.expectedMessage {
+			t.Errorf("Wrong error message, expected %q got %q",tt.expectedMessage,errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{"let a = 5; a;",5},
+		{"let a = 5 * 5; a;",25},
+		{"let a = 5; let b = a; b;",5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;",15},
+	}
+
+	for _,tt:=range tests {
+		testIntegerObject(t,testEval(tt.input),tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input:="fn(x) { x + 2; };"
+
+	evaluated:=testEval(input)
+	fn,ok:=evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("Expected a Function got %T (%+v)",evaluated,evaluated)
+	}
+
+	if len(fn.Params)!=1 {
+		t.Fatalf("Wrong number of parameters, expected 1 got %d",len(fn.Params))
+	}
+
+	if fn.Params[0].String()!="x" {
+		t.Fatalf("Expected parameter x got %q",fn.Params[0])
+	}
+
+	expectedBody:="{(x + 2)}"
+	if fn.Body.String()!=expectedBody {
+		t.Fatalf("Wrong body, expected %q got %q",expectedBody,fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);",5},
+		{"let identity = fn(x) { return x; }; identity(5);",5},
+		{"let double = fn(x) { x * 2; }; double(5);",10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);",10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",20},
+		{"fn(x) { x; }(5)",5},
+	}
+
+	for _,tt:=range tests {
+		testIntegerObject(t,testEval(tt.input),tt.expected)
+	}
+}
+
+func TestEmptyFunctionBody(t *testing.T) {
+	testNullObject(t,testEval("fn() {}()"))
+}
+
+func TestClosures(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected int64
+	}{
+		{`
+let add = fn(x) { fn(y) { x + y } };
+let addTwo = add(2);
+addTwo(3);`,5},
+		{`
+let add = fn(x) { fn(y) { x + y } };
+let addTwo = add(2);
+let addTen = add(10);
+addTwo(1) + addTen(1);`,14},
+		{`
+let x = 100;
+let f = fn(x) { fn() { x } };
+f(1)();`,1},
+		{`
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let inc = fn(x) { x + 1 };
+let double = fn(x) { x * 2 };
+compose(inc, double)(5);`,12},
+	}
+
+	for _,tt:=range tests {
+		testIntegerObject(t,testEval(tt.input),tt.expected)
+	}
+}
+
+func TestClosureCapturesDefiningEnvironment(t *testing.T) {
+	input:=`
+let x = 1;
+let f = fn() { x };
+let g = fn(x) { f() };
+g(50);`
+
+	testIntegerObject(t,testEval(input),1)
+}
+
+func TestStringLiteral(t *testing.T) {
+	evaluated:=testEval(`"Hello World!"`)
+	str,ok:=evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("Expected a String got %T (%+v)",evaluated,evaluated)
+	}
+	if str.Value!="Hello World!" {
+		t.Errorf("String has wrong value %q",str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	evaluated:=testEval(`let greet = fn(name) { "Hello" + " " + name + "!" }; greet("monkey")`)
+	str,ok:=evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("Expected a String got %T (%+v)",evaluated,evaluated)
+	}
+	if str.Value!="Hello monkey!" {
+		t.Errorf("String has wrong value %q",str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected bool
+	}{
+		{`"a" == "a"`,true},
+		{`"a" == "b"`,false},
+		{`"a" != "b"`,true},
+		{`"ab" == "a" + "b"`,true},
+	}
+
+	for _,tt:=range tests {
+		testBooleanObject(t,testEval(tt.input),tt.expected)
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expectedMessage string
+	}{
+		{`"Hello" - "World"`,"unknown operator: STRING - STRING"},
+		{`"Hello" + 1`,"type mismatch: STRING + INTEGER"},
+	}
+
+	for _,tt:=range tests {
+		errObj,ok:=testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error",tt.input)
+			continue
+		}
+		if errObj.Message!=tt.expectedMessage {
+			t.Errorf("Wrong error message, expected %q got %q",tt.expectedMessage,errObj.Message)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated:=testEval("[1, 2 * 2, 3 + 3]")
+	result,ok:=evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("Expected an Array got %T (%+v)",evaluated,evaluated)
+	}
+	if len(result.Elements)!=3 {
+		t.Fatalf("Expected 3 elements got %d",len(result.Elements))
+	}
+	testIntegerObject(t,result.Elements[0],1)
+	testIntegerObject(t,result.Elements[1],4)
+	testIntegerObject(t,result.Elements[2],6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]",1},
+		{"[1, 2, 3][2]",3},
+		{"let i = 0; [1][i];",1},
+		{"[1, 2, 3][1 + 1];",3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",6},
+		{"[1, 2, fn(x){x}][2](3)",3},
+		{"[[1, 2], [3, 4]][1][0]",3},
+		{"[1, 2, 3][3]","index out of range: 3 with length 3"},
+		{"[1, 2, 3][-1]","index out of range: -1 with length 3"},
+		{"[][0]","index out of range: 0 with length 0"},
+		{`[1]["0"]`,"index operator not supported: ARRAY[STRING]"},
+		{"1[0]","index operator not supported: INTEGER[INTEGER]"},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		switch expected:=tt.expected.(type) {
+		case int:
+			testIntegerObject(t,evaluated,int64(expected))
+		case string:
+			errObj,ok:=evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected an error got %T (%+v)",tt.input,evaluated,evaluated)
+				continue
+			}
+			if errObj.Message!=expected {
+				t.Errorf("Wrong error message, expected %q got %q",expected,errObj.Message)
+			}
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input:=`let two = "two";
+{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	true: 5,
+	false: 6
+}`
+	evaluated:=testEval(input)
+	result,ok:=evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Expected a Hash got %T (%+v)",evaluated,evaluated)
+	}
+
+	expected:=[]struct{
+		key object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"},1},
+		{&object.String{Value: "two"},2},
+		{&object.String{Value: "three"},3},
+		{&object.Integer{Value: 4},4},
+		{TRUE,5},
+		{FALSE,6},
+	}
+
+	if result.Len()!=len(expected) {
+		t.Fatalf("Hash has wrong number of pairs, got %d",result.Len())
+	}
+	for _,e:=range expected {
+		value,ok:=result.Get(e.key)
+		if !ok {
+			t.Errorf("No pair for key %s",e.key.Inspect())
+			continue
+		}
+		testIntegerObject(t,value,e.value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`,5},
+		{`{"foo": 5}["bar"]`,nil},
+		{`let key = "foo"; {"foo": 5}[key]`,5},
+		{`{}["foo"]`,nil},
+		{`{5: 5}[5]`,5},
+		{`{true: 5}[true]`,5},
+		{`{false: 5}[false]`,5},
+		{`{"name": "monkey", 1: true, false: 0}[false]`,0},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+		integer,ok:=tt.expected.(int)
+		if ok {
+			testIntegerObject(t,evaluated,int64(integer))
+		} else {
+			testNullObject(t,evaluated)
+		}
+	}
+}
+
+func TestUnhashableKeys(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expectedMessage string
+	}{
+		{`{"name": "Monkey"}[fn(x) { x }];`,"unusable as hash key: FUNCTION"},
+		{`{[1, 2]: 3}`,"unusable as hash key: ARRAY"},
+		{`{fn(x) { x }: 3}`,"unusable as hash key: FUNCTION"},
+		{`{{}: 3}`,"unusable as hash key: HASH"},
+	}
+
+	for _,tt:=range tests {
+		errObj,ok:=testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error",tt.input)
+			continue
+		}
+		if errObj.Message!=tt.expectedMessage {
+			t.Errorf("Wrong error message, expected %q got %q",tt.expectedMessage,errObj.Message)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected interface{}
+	}{
+		{`len("")`,0},
+		{`len("four")`,4},
+		{`len("hello world")`,11},
+		{`len("größe")`,5},
+		{`len([1, 2, 3])`,3},
+		{`len([])`,0},
+		{`len({"a": 1, "b": 2})`,2},
+		{`len(1)`,"argument 1 (value) to `len` must be STRING or ARRAY or HASH, got INTEGER"},
+		{`len("one", "two")`,"wrong number of arguments to `len`: want=1, got=2"},
+		{`first([1, 2, 3])`,1},
+		{`first([])`,nil},
+		{`first(1)`,"argument 1 (array) to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`,3},
+		{`last([])`,nil},
+		{`rest([1, 2, 3])`,[]int{2,3}},
+		{`rest([])`,nil},
+		{`push([], 1)`,[]int{1}},
+		{`push(1, 1)`,"argument 1 (array) to `push` must be ARRAY, got INTEGER"},
+		{`push([1])`,"wrong number of arguments to `push`: want=2, got=1"},
+		{`let a = [1]; let b = push(a, 2); len(a)`,1},
+		{`let len = fn(x) { 42 }; len([1])`,42},
+	}
+
+	for _,tt:=range tests {
+		evaluated:=testEval(tt.input)
+
+		switch expected:=tt.expected.(type) {
+		case int:
+			testIntegerObject(t,evaluated,int64(expected))
+		case nil:
+			testNullObject(t,evaluated)
+		case string:
+			errObj,ok:=evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected an error got %T (%+v)",tt.input,evaluated,evaluated)
+				continue
+			}
+			if errObj.Message!=expected {
+				t.Errorf("Wrong error message, expected %q got %q",expected,errObj.Message)
+			}
+		case []int:
+			array,ok:=evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%q: expected an Array got %T (%+v)",tt.input,evaluated,evaluated)
+				continue
+			}
+			if len(array.Elements)!=len(expected) {
+				t.Errorf("%q: wrong number of elements, expected %d got %d",tt.input,len(expected),len(array.Elements))
+				continue
+			}
+			for i,e:=range expected {
+				testIntegerObject(t,array.Elements[i],int64(e))
+			}
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var buf bytes.Buffer
+	saved:=object.Output
+	object.Output=&buf
+	defer func() { object.Output=saved }()
+
+	evaluated:=testEval(`puts("hello", 1, [true]); puts()`)
+	testNullObject(t,evaluated)
+
+	if buf.String()!="hello\n1\n[true]\n" {
+		t.Errorf("Unexpected output %q",buf.String())
+	}
+}
+
+func TestRegisteredBuiltin(t *testing.T) {
+	object.RegisterBuiltin(&object.Builtin{
+		Name: "testDouble",
+		Params: []object.Param{{Name: "n",Types: []object.ObjectType{object.INTEGER_OBJ}}},
+		Fn: func(args ...object.Object) object.Object {
+			return &object.Integer{Value: args[0].(*object.Integer).Value*2}
+		},
+	})
+
+	testIntegerObject(t,testEval(`testDouble(21)`),42)
+
+	errObj,ok:=testEval(`testDouble("x")`).(*object.Error)
+	if !ok || errObj.Message!="argument 1 (n) to `testDouble` must be INTEGER, got STRING" {
+		t.Errorf("Expected an argument type error got %v",errObj)
+	}
+}
@@ -16,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-*/5;
 5 < 10 > 5;
 
     if (5<10) {
@@ -70,8 +70,8 @@ let result = add(five, ten);
 		{token.SEMICOLON, ";"},
 		{token.BANG, "!"},
 		{token.MINUS, "-"},
-		{token.SLASH, "/"},
 		{token.ASTERISK, "*"},
+		{token.SLASH, "/"},
 		{token.INTEGER, "5"},
 		{token.SEMICOLON, ";"},
 		{token.INTEGER, "5"},
@@ -123,3 +123,389 @@ let result = add(five, ten);
 
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let ab = 10;\n  a==b\n"
+
+	tests := []struct {
+		expectedValue string
+		line, column, offset int
+		endColumn, endOffset int
+	}{
+		{"let", 1, 1, 0, 4, 3},
+		{"ab", 1, 5, 4, 7, 6},
+		{"=", 1, 8, 7, 9, 8},
+		{"10", 1, 10, 9, 12, 11},
+		{";", 1, 12, 11, 13, 12},
+		{"a", 2, 3, 15, 4, 16},
+		{"==", 2, 4, 16, 6, 18},
+		{"b", 2, 6, 18, 7, 19},
+		{"", 3, 1, 20, 1, 20},
+	}
+
+	l := NewFile("test.monkey", input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Value != test.expectedValue {
+			t.Fatalf("The value of the token %d is wrong, expected%q got%q", i, test.expectedValue, tok.Value)
+		}
+		if tok.Pos.File != "test.monkey" {
+			t.Errorf("token %d has file %q", i, tok.Pos.File)
+		}
+		if tok.Pos.Line != test.line || tok.Pos.Column != test.column || tok.Pos.Offset != test.offset {
+			t.Errorf("token %d (%q) starts at %d:%d offset %d, expected %d:%d offset %d", i, tok.Value,
+				tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset, test.line, test.column, test.offset)
+		}
+		if tok.End.Column != test.endColumn || tok.End.Offset != test.endOffset {
+			t.Errorf("token %d (%q) ends at column %d offset %d, expected column %d offset %d", i, tok.Value,
+				tok.End.Column, tok.End.Offset, test.endColumn, test.endOffset)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"foobar" "foo bar" "a\n\t\"b\"\\" "\u{48}\u{e9}\u{1F600}" ""`
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "a\n\t\"b\"\\"},
+		{token.STRING, "Hé😀"},
+		{token.STRING, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Type != test.expectedType || tok.Value != test.expectedValue {
+			t.Fatalf("token %d: expected %s %q got %s %q", i, test.expectedType, test.expectedValue, tok.Type, tok.Value)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("Expected no errors got %v", l.Errors())
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		code       string
+		errColumn  int
+		next       token.TokenType // the token after the broken string
+	}{
+		{"\"abc\nlet", ErrUnterminatedString, 1, token.LET},
+		{`"abc`, ErrUnterminatedString, 1, token.EOF},
+		{`"a\qb" ;`, ErrBadEscape, 3, token.SEMICOLON},
+		{`"\u{110000}" ;`, ErrBadEscape, 2, token.SEMICOLON},
+		{`"\u{}" ;`, ErrBadEscape, 2, token.SEMICOLON},
+		{`"\u41" ;`, ErrBadEscape, 2, token.SEMICOLON},
+		{`@ ;`, ErrIllegalChar, 1, token.SEMICOLON},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%q: expected ILLEGAL got %s %q", tt.input, tok.Type, tok.Value)
+			continue
+		}
+		errs := l.Errors()
+		if len(errs) != 1 {
+			t.Errorf("%q: expected one error got %v", tt.input, errs)
+			continue
+		}
+		if errs[0].Code != tt.code || errs[0].Pos.Column != tt.errColumn {
+			t.Errorf("%q: expected %s at column %d got %s at column %d (%s)", tt.input, tt.code, tt.errColumn, errs[0].Code, errs[0].Pos.Column, errs[0].Msg)
+		}
+		if next := l.NextToken(); next.Type != tt.next {
+			t.Errorf("%q: expected lexing to resume with %s got %s", tt.input, tt.next, next.Type)
+		}
+	}
+}
+
+func TestBrackets(t *testing.T) {
+	input := `[1, 2][0]`
+	expected := []token.TokenType{token.LBRACKET, token.INTEGER, token.COMMA, token.INTEGER, token.RBRACKET,
+		token.LBRACKET, token.INTEGER, token.RBRACKET, token.EOF}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("token %d: expected %q got %q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// a line comment
+let x = 10 / 2; // trailing
+/* a block
+   spanning lines */
+x /* inline */ * 2
+/* outer /* nested */ still a comment */ x
+//`
+	expected := []token.TokenType{token.LET, token.IDENTIFIER, token.ASSIGN, token.INTEGER, token.SLASH, token.INTEGER,
+		token.SEMICOLON, token.IDENTIFIER, token.ASTERISK, token.INTEGER, token.IDENTIFIER, token.EOF}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("token %d: expected %q got %q %q", i, tt, tok.Type, tok.Value)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("Expected no errors got %v", l.Errors())
+	}
+}
+
+func TestCommentTokens(t *testing.T) {
+	input := "x // note\n/* a /* b */ c */ y"
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+		line, column  int
+	}{
+		{token.IDENTIFIER, "x", 1, 1},
+		{token.COMMENT, "// note", 1, 3},
+		{token.COMMENT, "/* a /* b */ c */", 2, 1},
+		{token.IDENTIFIER, "y", 2, 19},
+		{token.EOF, "", 2, 20},
+	}
+
+	l := New(input, WithComments())
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Value != tt.expectedValue {
+			t.Fatalf("token %d: expected %s %q got %s %q", i, tt.expectedType, tt.expectedValue, tok.Type, tok.Value)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Errorf("token %d: expected %d:%d got %d:%d", i, tt.line, tt.column, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	for _, input := range []string{"1 /* open", "1 /* a /* b */ c", "1 /*/"} {
+		l := New(input)
+		l.NextToken()
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%q: expected ILLEGAL got %s %q", input, tok.Type, tok.Value)
+			continue
+		}
+		errs := l.Errors()
+		if len(errs) != 1 || errs[0].Code != ErrUnterminatedComment || errs[0].Pos.Column != 3 {
+			t.Errorf("%q: expected %s at column 3 got %v", input, ErrUnterminatedComment, errs)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%q: expected EOF after the comment got %s", input, next.Type)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"😀 ok\"; π2 + _x\n日本 @"
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+		column        int
+		offset        int
+	}{
+		{token.LET, "let", 1, 0},
+		{token.IDENTIFIER, "größe", 5, 4},
+		{token.ASSIGN, "=", 11, 12},
+		{token.STRING, "😀 ok", 13, 14},
+		{token.SEMICOLON, ";", 19, 23},
+		{token.IDENTIFIER, "π2", 21, 25},
+		{token.PLUS, "+", 24, 29},
+		{token.IDENTIFIER, "_x", 26, 31},
+		{token.IDENTIFIER, "日本", 1, 34},
+		{token.ILLEGAL, "@", 4, 41},
+		{token.EOF, "", 5, 42},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Value != tt.expectedValue {
+			t.Fatalf("token %d: expected %s %q got %s %q", i, tt.expectedType, tt.expectedValue, tok.Type, tok.Value)
+		}
+		if tok.Pos.Column != tt.column || tok.Pos.Offset != tt.offset {
+			t.Errorf("token %d %q: expected column %d offset %d got column %d offset %d", i, tok.Value, tt.column, tt.offset, tok.Pos.Column, tok.Pos.Offset)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		input     string
+		errColumn int
+		errOffset int
+	}{
+		{"é\xff ;", 2, 2},
+		{"\"ab\xc3\" ;", 4, 3},
+		{"// note \xfe\n;", 9, 8},
+		{"/* \x80 */ ;", 4, 3},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type == token.IDENTIFIER { // the é
+			tok = l.NextToken()
+		}
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%q: expected ILLEGAL got %s %q", tt.input, tok.Type, tok.Value)
+			continue
+		}
+		errs := l.Errors()
+		if len(errs) != 1 || errs[0].Code != ErrInvalidUTF8 {
+			t.Errorf("%q: expected one %s got %v", tt.input, ErrInvalidUTF8, errs)
+			continue
+		}
+		if errs[0].Pos.Column != tt.errColumn || errs[0].Pos.Offset != tt.errOffset || errs[0].End.Offset != tt.errOffset+1 {
+			t.Errorf("%q: expected the error at column %d offset %d got %+v", tt.input, tt.errColumn, tt.errOffset, errs[0])
+		}
+		if next := l.NextToken(); next.Type != token.SEMICOLON {
+			t.Errorf("%q: expected lexing to resume with ; got %s", tt.input, next.Type)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "0xFF 0o17 0b1_0 1_000 007 0x_a 5;"
+	expected := []string{"0xFF", "0o17", "0b1_0", "1_000", "007", "0x_a", "5"}
+
+	l := New(input)
+	for i, value := range expected {
+		tok := l.NextToken()
+		if tok.Type != token.INTEGER || tok.Value != value {
+			t.Fatalf("token %d: expected INT %q got %s %q", i, value, tok.Type, tok.Value)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("Expected no errors got %v", l.Errors())
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		value string
+		msg   string
+	}{
+		{"0x ;", "0x", "hexadecimal literal 0x has no digits"},
+		{"0b102 ;", "0b102", "invalid digit '2' in binary literal 0b102"},
+		{"0o8 ;", "0o8", "invalid digit '8' in octal literal 0o8"},
+		{"0x1G ;", "0x1G", "invalid digit 'G' in hexadecimal literal 0x1G"},
+		{"12ab ;", "12ab", "invalid digit 'a' in decimal literal 12ab"},
+		{"1__000 ;", "1__000", "_ must separate successive digits in 1__000"},
+		{"1000_ ;", "1000_", "_ must separate successive digits in 1000_"},
+		{"0b_ ;", "0b_", "_ must separate successive digits in 0b_"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL || tok.Value != tt.value {
+			t.Errorf("%q: expected ILLEGAL %q got %s %q", tt.input, tt.value, tok.Type, tok.Value)
+			continue
+		}
+		errs := l.Errors()
+		if len(errs) != 1 || errs[0].Code != ErrBadNumber || errs[0].Msg != tt.msg {
+			t.Errorf("%q: expected %s %q got %v", tt.input, ErrBadNumber, tt.msg, errs)
+			continue
+		}
+		if errs[0].Pos.Column != 1 || errs[0].End.Column != len(tt.value)+1 {
+			t.Errorf("%q: expected the error to cover the literal got %+v", tt.input, errs[0])
+		}
+		if next := l.NextToken(); next.Type != token.SEMICOLON {
+			t.Errorf("%q: expected lexing to resume with ; got %s", tt.input, next.Type)
+		}
+	}
+}
+
+func TestOperatorTokens(t *testing.T) {
+	input := "&& || & | ^ ~ % ** * <= >= << >> < > <<= **="
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+	}{
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.ASTERISK, "*"},
+		{token.LTE, "<="},
+		{token.GTE, ">="},
+		{token.SHL, "<<"},
+		{token.SHR, ">>"},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		// only two characters are ever taken together
+		{token.SHL, "<<"},
+		{token.ASSIGN, "="},
+		{token.POWER, "**"},
+		{token.ASSIGN, "="},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Value != tt.expectedValue {
+			t.Fatalf("token %d: expected %s %q got %s %q", i, tt.expectedType, tt.expectedValue, tok.Type, tok.Value)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := "while for in break continue inside fork"
+	expected := []token.TokenType{
+		token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE,
+		token.IDENTIFIER, token.IDENTIFIER, token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("token %d: expected %s got %s %q", i, want, tok.Type, tok.Value)
+		}
+	}
+}
+
+func TestAssignTokens(t *testing.T) {
+	input := "= += -= *= /= == **= + -"
+	expected := []token.TokenType{
+		token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN,
+		token.EQ, token.POWER, token.ASSIGN, token.PLUS, token.MINUS, token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("token %d: expected %s got %s %q", i, want, tok.Type, tok.Value)
+		}
+	}
+}
+
+func TestConstKeyword(t *testing.T) {
+	l := New("const constant")
+	for i, want := range []token.TokenType{token.CONST, token.IDENTIFIER, token.EOF} {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("token %d: expected %s got %s %q", i, want, tok.Type, tok.Value)
+		}
+	}
+}
@@ -1,20 +1,93 @@
 package lexer
 
 import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/Sumz-K/Go-Interpreter/token"
 )
 
+// error codes of the problems the lexer finds, the parser reports them as diagnostics
+const (
+    ErrIllegalChar = "E0101" // a character that cannot start any token
+    ErrUnterminatedString = "E0102" // a string literal without its closing quote
+    ErrBadEscape = "E0103" // an unknown or malformed escape sequence in a string
+    ErrUnterminatedComment = "E0104" // a /* comment without its closing */
+    ErrInvalidUTF8 = "E0105" // bytes that are not valid UTF-8, anywhere in the input
+    ErrBadNumber = "E0106" // a number literal with a digit its base does not have or a misplaced _
+)
+
+// a problem found while lexing, the token it belongs to is returned as ILLEGAL
+type Error struct {
+    Code string
+    Msg string
+    Pos token.Position
+    End token.Position
+}
+
+// The input is read as UTF-8. Offsets in positions count bytes, columns count
+// runes, so a column is what an editor shows for text without tabs.
+//
+// An identifier starts with a letter or _ and goes on with letters, digits and _,
+// where letters and digits are those of Unicode (categories L and Nd), so größe
+// and π2 are identifiers. Identifiers are compared as written, no normalization
+// is done.
+//
+// Integer literals are decimal, or hex, octal and binary with a 0x, 0o or 0b
+// prefix. A _ may separate two digits or the prefix from the first digit, as in
+// 1_000_000 and 0b_1010. Leading zeros do not make a decimal literal octal, 010
+// is ten. The lexer only checks the spelling, the parser finds out if it fits
 type Lexer struct {
-    input string  //input to lex
+    input string  //input to lex, only a window of it when reading from an io.Reader
+    base int //offset of input[0] in the whole input
     position int  //where we read from before  position
     readPosition int  //nextPosition to "peek"
-    char byte //represents the character at the current position
+    char rune //represents the character at the current position
+
+    file string //name reported in token positions, may be empty
+    line int //line of the character at position
+    column int //column of the character at position
+
+    comments bool //return comments as COMMENT tokens instead of skipping them
+
+    src io.Reader //where the rest of the input comes from, nil once it is all in input
+    keep int //offset of the start of the token being read, input before it can be dropped
+    chunk int //how much to read from src at a time
+    err error //the first error src returned other than io.EOF
+
+    errors []Error
+}
+
+// Option changes how a Lexer behaves, pass it to New or NewFile
+type Option func(*Lexer)
+
+// WithComments makes the lexer return every comment as a COMMENT token holding
+// its source text, for tools like formatters that need to see them. The parser
+// skips them either way
+func WithComments() Option {
+    return func(l *Lexer) {
+        l.comments=true
+    }
 }
 
 // To return a lexer type given an input 
-func New(input string) *Lexer {
+func New(input string, opts ...Option) *Lexer {
+    return NewFile("",input,opts...)
+}
+
+// same as New but every token position carries the given file name
+func NewFile(file string, input string, opts ...Option) *Lexer {
     l:=&Lexer{
         input: input,
+        file: file,
+        line: 1,
+    }
+    for _,opt:=range opts {
+        opt(l)
     }
     l.readChar()
     return l
@@ -22,54 +95,167 @@ func New(input string) *Lexer {
 
 
 func (l *Lexer) readChar() {
-    if l.readPosition>=len(l.input) {
+    if l.char=='\n' { // leaving a newline so the next char starts a new line
+        l.line+=1
+        l.column=0
+    }
+    width:=1
+    l.fill(l.readPosition+utf8.UTFMax)
+    if l.readPosition>=l.base+len(l.input) {
         l.char=0
     } else {
-        l.char=l.input[l.readPosition]
+        l.char,width=utf8.DecodeRuneInString(l.input[l.readPosition-l.base:])
     }
 
     l.position=l.readPosition
-    l.readPosition+=1
+    l.readPosition+=width
+    l.column+=1
+}
+
+// the current char is a byte that does not start valid UTF-8, not a U+FFFD in the input
+func (l *Lexer) invalid() bool {
+    return l.char==utf8.RuneError && l.readPosition-l.position==1
+}
+
+func (l *Lexer) addInvalidUTF8() {
+    l.addError(ErrInvalidUTF8,l.pos(),l.after(),"invalid UTF-8 encoding, byte %#x",l.input[l.position-l.base])
+}
+
+// the input from offset start up to end
+func (l *Lexer) text(start,end int) string {
+    return l.input[start-l.base:end-l.base]
+}
+
+// position of the current character
+func (l *Lexer) pos() token.Position {
+    return token.Position{
+        File: l.file,
+        Line: l.line,
+        Column: l.column,
+        Offset: l.position,
+    }
+}
+
+// the errors found so far, in the order of the tokens they belong to
+func (l *Lexer) Errors() []Error {
+    return l.errors
 }
 
-func (l* Lexer) peek() byte {
-    if l.readPosition>=len(l.input) {
+func (l *Lexer) addError(code string, start,end token.Position, format string, a ...interface{}) {
+    l.errors = append(l.errors, Error{Code: code,Msg: fmt.Sprintf(format,a...),Pos: start,End: end})
+}
+
+func (l* Lexer) peek() rune {
+    l.fill(l.readPosition+utf8.UTFMax)
+    if l.readPosition>=l.base+len(l.input) {
         return 0
     }
-    return l.input[l.readPosition]
+    r,_:=utf8.DecodeRuneInString(l.input[l.readPosition-l.base:])
+    return r
 }
 
 func (l* Lexer) readID() string{
     start:=l.position
-    for l.isLetter() {
+    for l.isLetter() || unicode.IsDigit(l.char) {
         l.readChar()
     }
-    return l.input[start:l.position]
+    return l.text(start,l.position)
 }
 
-func (l* Lexer) readNumber() string {
-    start:=l.position
-    for l.isDigit() {
+// reads a number literal and every letter, digit and _ stuck to it, so 0x1G or
+// 12ab are one malformed literal rather than a number followed by a name
+func (l* Lexer) readNumber() token.Token {
+    start:=l.pos()
+    for l.isLetter() || unicode.IsDigit(l.char) {
         l.readChar()
     }
-    return l.input[start:l.position]
+    tok:=token.Token{Type: token.INTEGER,Value: l.text(start.Offset,l.position),Pos: start,End: l.pos()}
+    if msg:=checkNumber(tok.Value);msg!="" {
+        tok.Type=token.ILLEGAL
+        l.addError(ErrBadNumber,start,tok.End,"%s",msg)
+    }
+    return tok
+}
+
+// what is wrong with the spelling of a number literal, if anything
+func checkNumber(lit string) string {
+    base,name,digits:=10,"decimal",lit
+    if len(lit)>=2 && lit[0]=='0' {
+        switch lit[1] {
+        case 'x','X':
+            base,name=16,"hexadecimal"
+        case 'o','O':
+            base,name=8,"octal"
+        case 'b','B':
+            base,name=2,"binary"
+        }
+        if base!=10 {
+            digits=lit[2:]
+        }
+    }
+
+    if digits=="" {
+        return fmt.Sprintf("%s literal %s has no digits",name,lit)
+    }
+    // a _ may follow a digit or the prefix, and a digit has to follow it
+    canSeparate:=base!=10
+    for _,r:=range digits {
+        if r=='_' {
+            if !canSeparate {
+                return fmt.Sprintf("_ must separate successive digits in %s",lit)
+            }
+            canSeparate=false
+            continue
+        }
+        if digitValue(r)>=base {
+            return fmt.Sprintf("invalid digit %q in %s literal %s",r,name,lit)
+        }
+        canSeparate=true
+    }
+    if strings.HasSuffix(digits,"_") {
+        return fmt.Sprintf("_ must separate successive digits in %s",lit)
+    }
+    return ""
+}
+
+// the value of a digit in any base up to 16, 16 for anything else
+func digitValue(r rune) int {
+    switch {
+    case r>='0' && r<='9':
+        return int(r-'0')
+    case r>='a' && r<='f':
+        return int(r-'a')+10
+    case r>='A' && r<='F':
+        return int(r-'A')+10
+    }
+    return 16
 }
 
 func (l* Lexer) isLetter() bool{
-    return l.char>='a' && l.char<='z' || l.char>='A' && l.char<='Z'
+    return unicode.IsLetter(l.char) || l.char=='_'
 }
 func (l* Lexer) isDigit() bool {
     return l.char>='0' && l.char<='9'
 }
 func (l* Lexer) ignoreWhiteSpace() {
     for l.char==' ' || l.char=='\t' || l.char=='\n' || l.char=='\r'{
+        l.keep=l.readPosition // nothing to keep of the whitespace
         l.readChar()
     }
+    l.keep=l.position
 }
 func (l* Lexer) NextToken() token.Token {
     
     l.ignoreWhiteSpace()
+    for l.char=='/' && (l.peek()=='/' || l.peek()=='*') {
+        tok:=l.readComment()
+        if l.comments || tok.Type==token.ILLEGAL {
+            return tok
+        }
+        l.ignoreWhiteSpace() // a skipped comment need not be kept either
+    }
     currChar:=l.char
+    start:=l.pos()
 
     var tok token.Token
 
@@ -82,13 +268,19 @@ func (l* Lexer) NextToken() token.Token {
             tok=createToken(token.ASSIGN,l.char)
         }
     case '+':
-        tok=createToken(token.PLUS,l.char)
+        tok=l.twoCharToken(token.PLUS,map[rune]token.TokenType{'=': token.PLUS_ASSIGN})
     case '-':
-        tok=createToken(token.MINUS,l.char)
+        tok=l.twoCharToken(token.MINUS,map[rune]token.TokenType{'=': token.MINUS_ASSIGN})
     case '*':
-        tok=createToken(token.ASTERISK,l.char)
+        tok=l.twoCharToken(token.ASTERISK,map[rune]token.TokenType{'*': token.POWER,'=': token.ASTERISK_ASSIGN})
+    case '%':
+        tok=createToken(token.PERCENT,l.char)
+    case '^':
+        tok=createToken(token.CARET,l.char)
+    case '~':
+        tok=createToken(token.TILDE,l.char)
     case '/':
-        tok=createToken(token.SLASH,l.char)
+        tok=l.twoCharToken(token.SLASH,map[rune]token.TokenType{'=': token.SLASH_ASSIGN})
     case '!':
         if l.peek() == '=' {
             l.readChar()
@@ -96,14 +288,30 @@ func (l* Lexer) NextToken() token.Token {
         } else {
             tok=createToken(token.BANG,l.char)
         }
+    case '&':
+        if l.peek()=='&' {
+            l.readChar()
+            tok=token.Token{Type: token.AND,Value: "&&"}
+        } else {
+            tok=createToken(token.AMPERSAND,l.char)
+        }
+    case '|':
+        if l.peek()=='|' {
+            l.readChar()
+            tok=token.Token{Type: token.OR,Value: "||"}
+        } else {
+            tok=createToken(token.PIPE,l.char)
+        }
     case '<':
-        tok=createToken(token.LT,l.char)
+        tok=l.twoCharToken(token.LT,map[rune]token.TokenType{'=': token.LTE,'<': token.SHL})
     case '>':
-        tok=createToken(token.GT,l.char)
+        tok=l.twoCharToken(token.GT,map[rune]token.TokenType{'=': token.GTE,'>': token.SHR})
     case ';':
         tok=createToken(token.SEMICOLON,l.char)
     case ',':
         tok=createToken(token.COMMA,l.char)
+    case ':':
+        tok=createToken(token.COLON,l.char)
     case '(':
         tok=createToken(token.LPAREN,l.char)
     case ')':
@@ -112,32 +320,215 @@ func (l* Lexer) NextToken() token.Token {
         tok=createToken(token.LBRACE,l.char)
     case '}':
         tok=createToken(token.RBRACE,l.char)
+    case '[':
+        tok=createToken(token.LBRACKET,l.char)
+    case ']':
+        tok=createToken(token.RBRACKET,l.char)
+    case '"':
+        return l.readString()
     case 0:
         tok.Value=""
         tok.Type=token.EOF
+        tok.Pos=start
+        tok.End=start
+        return tok
     default:
         if l.isLetter() {
             tok.Value=l.readID()
             tok.Type=token.CheckID(tok.Value)
+            tok.Pos=start
+            tok.End=l.pos() // readID already stopped on the char after the identifier
             return tok
         }  else if l.isDigit() {
-            tok.Value=l.readNumber()
-            tok.Type=token.INTEGER
-            return tok
+            return l.readNumber()
+        } else if l.invalid() {
+            tok=token.Token{Type: token.ILLEGAL,Value: l.text(l.position,l.readPosition)}
+            l.addInvalidUTF8()
         } else {
             tok=createToken(token.ILLEGAL,l.char)
+            l.addError(ErrIllegalChar,start,l.after(),"unexpected character %q",l.char)
         }
 
     }
     
     l.readChar()
+    tok.Pos=start
+    tok.End=l.pos()
     return tok
 }
 
 
-func createToken(tokenType token.TokenType, ch byte) token.Token {
+// the current char alone is single, followed by a char in double it is that token instead
+func (l *Lexer) twoCharToken(single token.TokenType, double map[rune]token.TokenType) token.Token {
+    if tokenType,ok:=double[l.peek()];ok {
+        ch:=l.char
+        l.readChar()
+        return token.Token{Type: tokenType,Value: string(ch)+string(l.char)}
+    }
+    return createToken(single,l.char)
+}
+
+func createToken(tokenType token.TokenType, ch rune) token.Token {
     return token.Token{
         Type: tokenType,
         Value: string(ch),
     }
 }
+
+
+// reads a // comment up to the end of the line or a /* */ comment starting at
+// its first slash. Block comments nest, so a block holding another /* */ can be
+// commented out as a whole. A block left open comes back as ILLEGAL
+func (l *Lexer) readComment() token.Token {
+    start:=l.pos()
+    errs:=len(l.errors)
+    if l.peek()=='/' {
+        for l.char!='\n' && l.char!=0 {
+            if l.invalid() {
+                l.addInvalidUTF8()
+            }
+            l.readChar()
+        }
+        return l.commentToken(start,errs)
+    }
+
+    l.readChar()
+    l.readChar()
+    depth:=1
+    for depth>0 {
+        switch {
+        case l.char==0:
+            end:=l.pos()
+            l.addError(ErrUnterminatedComment,start,end,"comment not terminated, /* */ comments nest so every /* needs its own */")
+            return token.Token{Type: token.ILLEGAL,Value: l.text(start.Offset,end.Offset),Pos: start,End: end}
+        case l.char=='/' && l.peek()=='*':
+            depth++
+            l.readChar()
+        case l.char=='*' && l.peek()=='/':
+            depth--
+            l.readChar()
+        case l.invalid():
+            l.addInvalidUTF8()
+        }
+        l.readChar()
+    }
+    return l.commentToken(start,errs)
+}
+
+// a comment that ran into invalid UTF-8 comes back as ILLEGAL so the parser reports it
+func (l *Lexer) commentToken(start token.Position, errs int) token.Token {
+    tok:=token.Token{Type: token.COMMENT,Value: l.text(start.Offset,l.position),Pos: start,End: l.pos()}
+    if len(l.errors)>errs {
+        tok.Type=token.ILLEGAL
+    }
+    return tok
+}
+
+// reads a double quoted string starting at the opening quote and decoding its
+// escapes. The token Value is the decoded text, a malformed literal comes back
+// as an ILLEGAL token holding the source text with the error recorded
+func (l *Lexer) readString() token.Token {
+    start:=l.pos()
+    var buf strings.Builder
+    ok:=true
+
+    for {
+        l.readChar()
+        switch l.char {
+        case '"':
+            l.readChar()
+            tok:=token.Token{Type: token.STRING,Value: buf.String(),Pos: start,End: l.pos()}
+            if !ok {
+                tok.Type=token.ILLEGAL
+                tok.Value=l.text(start.Offset,tok.End.Offset)
+            }
+            return tok
+        case 0,'\n': // strings cannot span lines, use \n
+            end:=l.pos()
+            l.addError(ErrUnterminatedString,start,end,"string literal not terminated")
+            return token.Token{Type: token.ILLEGAL,Value: l.text(start.Offset,end.Offset),Pos: start,End: end}
+        case '\\':
+            if !l.readEscape(&buf) {
+                ok=false
+            }
+        default:
+            if l.invalid() {
+                l.addInvalidUTF8()
+                ok=false
+            }
+            buf.WriteRune(l.char)
+        }
+    }
+}
+
+// decodes the escape sequence whose backslash is the current char, leaving
+// the lexer on its last char. Supported are \n \t \r \" \\ and \u{XXXX}
+// with one to six hex digits naming a Unicode code point
+func (l *Lexer) readEscape(buf *strings.Builder) bool {
+    start:=l.pos()
+    if l.peek()==0 || l.peek()=='\n' { // let readString report the missing quote
+        return true
+    }
+    l.readChar()
+
+    switch l.char {
+    case 'n':
+        buf.WriteByte('\n')
+    case 't':
+        buf.WriteByte('\t')
+    case 'r':
+        buf.WriteByte('\r')
+    case '"':
+        buf.WriteByte('"')
+    case '\\':
+        buf.WriteByte('\\')
+    case 'u':
+        return l.readUnicodeEscape(buf,start)
+    default:
+        l.addError(ErrBadEscape,start,l.after(),"unknown escape sequence \\%c",l.char)
+        return false
+    }
+    return true
+}
+
+// \u{...}, the current char is the u
+func (l *Lexer) readUnicodeEscape(buf *strings.Builder, start token.Position) bool {
+    if l.peek()!='{' {
+        l.addError(ErrBadEscape,start,l.after(),"\\u must be followed by a code point in braces, like \\u{1F600}")
+        return false
+    }
+    l.readChar()
+
+    digits:=l.position+1
+    for isHexDigit(l.peek()) {
+        l.readChar()
+    }
+    hex:=l.text(digits,l.readPosition)
+
+    if l.peek()!='}' || len(hex)==0 || len(hex)>6 {
+        l.addError(ErrBadEscape,start,l.after(),"\\u{...} needs one to six hex digits and a closing brace")
+        return false
+    }
+    l.readChar()
+
+    code,_:=strconv.ParseUint(hex,16,32)
+    r:=rune(code)
+    if !utf8.ValidRune(r) {
+        l.addError(ErrBadEscape,start,l.after(),"\\u{%s} is not a valid Unicode code point",hex)
+        return false
+    }
+    buf.WriteRune(r)
+    return true
+}
+
+// position just past the current char
+func (l *Lexer) after() token.Position {
+    pos:=l.pos()
+    pos.Column+=1
+    pos.Offset=l.readPosition
+    return pos
+}
+
+func isHexDigit(ch rune) bool {
+    return ch>='0' && ch<='9' || ch>='a' && ch<='f' || ch>='A' && ch<='F'
+}
@@ -0,0 +1,80 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+// how much NewReader reads at a time
+const readChunk=64<<10
+
+// NewReader lexes what it reads from r, which it reads as the tokens are asked for.
+// Only the token being read and what is left of the last chunk are held in memory,
+// so the input can be far larger than what fits at once. A comment or string is
+// held whole while it is read. Positions count from the start of r as they do for
+// New, but token values and errors are all that is kept of the text, use Err to
+// find out whether r failed before its end
+func NewReader(file string, r io.Reader, opts ...Option) *Lexer {
+    l:=&Lexer{
+        file: file,
+        line: 1,
+        src: r,
+        chunk: readChunk,
+    }
+    for _,opt:=range opts {
+        opt(l)
+    }
+    l.readChar()
+    return l
+}
+
+// Err returns the first error the reader of a NewReader lexer failed with, the
+// lexer stops with EOF then. It is nil at the end of the input and for lexers
+// made from a string
+func (l *Lexer) Err() error {
+    return l.err
+}
+
+// reads from src until the input reaches offset end or src runs out, dropping
+// what is before the token being read to make room
+func (l *Lexer) fill(end int) {
+    if l.src==nil || end<=l.base+len(l.input) {
+        return
+    }
+    // the window only ever holds the token being read and a chunk past it
+    l.input=l.input[l.keep-l.base:]
+    l.base=l.keep
+
+    buf:=make([]byte,l.chunk)
+    for l.src!=nil && end>l.base+len(l.input) {
+        n,err:=l.src.Read(buf)
+        l.input+=string(buf[:n])
+        if err!=nil {
+            if !errors.Is(err,io.EOF) {
+                l.err=err
+            }
+            l.src=nil
+        }
+    }
+}
+
+// Tokens yields the tokens of the input up to, but not including, EOF:
+//
+//	for tok:=range lexer.NewReader(name,f).Tokens() {
+//		...
+//	}
+//
+// Breaking out of the loop early leaves the tokens after the last one yielded to NextToken
+func (l *Lexer) Tokens() iter.Seq[token.Token] {
+    return func(yield func(token.Token) bool) {
+        for {
+            tok:=l.NextToken()
+            if tok.Type==token.EOF || !yield(tok) {
+                return
+            }
+        }
+    }
+}
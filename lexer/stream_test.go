@@ -0,0 +1,107 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+const streamInput = `// größe of things
+let add = fn(x, y) { x + y; };
+/* nested /* comment */ here */
+let s = "😀 \u{1F600} \"q\"";
+add(1, 22) != 333; "open
+@`
+
+// reads n bytes at a time, the first read happens in NewReader already
+func withChunk(n int) Option {
+	return func(l *Lexer) {
+		l.chunk = n
+	}
+}
+
+// a reader lexer has to give the same tokens and errors as a string lexer,
+// however the input is cut up into reads
+func TestReaderMatchesString(t *testing.T) {
+	expected := New(streamInput, WithComments())
+	var want []token.Token
+	for tok := expected.NextToken(); ; tok = expected.NextToken() {
+		want = append(want, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	for _, chunk := range []int{1, 2, 3, 7, readChunk} {
+		l := NewReader("", iotest.OneByteReader(strings.NewReader(streamInput)), WithComments(), withChunk(chunk))
+		for i, w := range want {
+			tok := l.NextToken()
+			if tok != w {
+				t.Fatalf("chunk %d token %d: expected %+v got %+v", chunk, i, w, tok)
+			}
+		}
+		if len(l.Errors()) != len(expected.Errors()) {
+			t.Errorf("chunk %d: expected errors %v got %v", chunk, expected.Errors(), l.Errors())
+		}
+		if l.Err() != nil {
+			t.Errorf("chunk %d: unexpected read error %v", chunk, l.Err())
+		}
+	}
+}
+
+// lexing a large input keeps no more than a chunk and a token in memory
+func TestReaderBoundedMemory(t *testing.T) {
+	const lines = 20000
+	r := io.MultiReader(strings.NewReader(strings.Repeat("let x = 10 + y; // some comment\n", lines)),
+		strings.NewReader("\"a string that stays whole\""))
+	l := NewReader("big.monkey", r, withChunk(256))
+
+	count, largest := 0, 0
+	var last token.Token
+	for tok := range l.Tokens() {
+		count++
+		largest = max(largest, len(l.input))
+		last = tok
+	}
+	if count != lines*7+1 {
+		t.Errorf("Expected %d tokens got %d", lines*7+1, count)
+	}
+	if largest > 2*l.chunk {
+		t.Errorf("Expected the buffer to stay within two chunks got %d bytes", largest)
+	}
+	if last.Type != token.STRING || last.Pos.Line != lines+1 || last.Pos.Offset != lines*32 {
+		t.Errorf("Wrong last token %+v", last)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	failure := errors.New("disk on fire")
+	l := NewReader("", io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(failure)))
+
+	var types []token.TokenType
+	for tok := range l.Tokens() {
+		types = append(types, tok.Type)
+	}
+	if len(types) != 2 || types[0] != token.LET || types[1] != token.IDENTIFIER {
+		t.Errorf("Expected the tokens read before the error got %v", types)
+	}
+	if !errors.Is(l.Err(), failure) {
+		t.Errorf("Expected the read error got %v", l.Err())
+	}
+}
+
+func TestTokensStopsEarly(t *testing.T) {
+	l := New("1 2 3")
+	for tok := range l.Tokens() {
+		if tok.Value == "2" {
+			break
+		}
+	}
+	if tok := l.NextToken(); tok.Value != "3" {
+		t.Errorf("Expected lexing to go on with 3 got %q", tok.Value)
+	}
+}
@@ -1,18 +1,306 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/compiler"
+	"github.com/Sumz-K/Go-Interpreter/diag"
+	"github.com/Sumz-K/Go-Interpreter/disasm"
+	"github.com/Sumz-K/Go-Interpreter/evaluator"
+	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/parser"
 	"github.com/Sumz-K/Go-Interpreter/repl"
+	"github.com/Sumz-K/Go-Interpreter/token"
+	"github.com/Sumz-K/Go-Interpreter/vm"
 )
 
+// exit codes, so scripts calling monkey can tell what went wrong
+const (
+    exitOK = 0
+    exitUsage = 1 // bad arguments or the input could not be read
+    exitSyntax = 2 // the program did not parse or compile
+    exitRuntime = 3 // the program parsed but failed while running
+)
+
+const usage = `usage: monkey <command> [flags] [file]
+
+commands:
+    run [-vm] <file>  run a program, with -vm it is compiled and run on the vm.
+                      Compiled .mkc files always run on the vm
+    build [-o out.mkc] [-strip] <file>
+                      compile a program to a .mkc file next to it, -strip
+                      leaves out the line table
+    disasm <file>     print the bytecode of a program or a .mkc file
+    tokens <file>     print the tokens the lexer produces
+    ast <file>        print the parsed syntax tree
+    repl              start an interactive session (the default)
+
+a file of - reads the program from standard input
+`
+
 func main() {
-    file,err:=os.Open("monkey/code1.monkey")
+    os.Exit(run(os.Args[1:],os.Stdin,os.Stdout,os.Stderr))
+}
+
+// run is main without the os dependencies, it returns the exit code.
+// What programs print with puts goes to stdout as well
+func run(args []string, stdin io.Reader, stdout,stderr io.Writer) int {
+    saved:=object.Output
+    object.Output=stdout
+    defer func() { object.Output=saved }()
+
+    if len(args)==0 {
+        repl.Start(stdin,stdout)
+        return exitOK
+    }
+
+    cmd:=args[0]
+    switch cmd {
+    case "repl":
+        repl.Start(stdin,stdout)
+        return exitOK
+    case "help","-h","-help","--help":
+        io.WriteString(stdout,usage)
+        return exitOK
+    case "run","build","disasm","tokens","ast":
+    default:
+        fmt.Fprintf(stderr,"monkey: unknown command %q\n\n%s",cmd,usage)
+        return exitUsage
+    }
+
+    // flags go between the command and the file
+    var (
+        useVM,strip bool
+        out string
+    )
+    flags:=flag.NewFlagSet(cmd,flag.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    switch cmd {
+    case "run":
+        flags.BoolVar(&useVM,"vm",false,"")
+    case "build":
+        flags.StringVar(&out,"o","","")
+        flags.BoolVar(&strip,"strip",false,"")
+    }
+    if err:=flags.Parse(args[1:]);err!=nil {
+        fmt.Fprintf(stderr,"monkey: %s: %v\n\n%s",cmd,err,usage)
+        return exitUsage
+    }
+    if flags.NArg()!=1 {
+        fmt.Fprintf(stderr,"monkey: %s takes exactly one file\n\n%s",cmd,usage)
+        return exitUsage
+    }
+    path:=flags.Arg(0)
+    name,src,err:=readSource(path,stdin)
     if err!=nil {
-        log.Fatal("Cannot open file")
+        fmt.Fprintf(stderr,"monkey: %v\n",err)
+        return exitUsage
+    }
+
+    // a compiled file can only be run or disassembled
+    if compiler.IsBytecode([]byte(src)) {
+        switch cmd {
+        case "run":
+            return runBytecode(name,[]byte(src),stderr)
+        case "disasm":
+            return disassembleBytecode(name,[]byte(src),stdout,stderr)
+        }
+        fmt.Fprintf(stderr,"monkey: %s is already compiled, %s needs a source file\n",name,cmd)
+        return exitUsage
+    }
+
+    switch cmd {
+    case "tokens":
+        return dumpTokens(name,src,stdout,stderr)
+    case "ast":
+        return dumpAST(name,src,stdout,stderr)
+    case "build":
+        if out=="" {
+            if path=="-" {
+                fmt.Fprintf(stderr,"monkey: build from standard input needs -o\n")
+                return exitUsage
+            }
+            out=strings.TrimSuffix(path,filepath.Ext(path))+".mkc"
+        }
+        return buildProgram(name,src,out,strip,stderr)
+    case "disasm":
+        return disassemble(name,src,stdout,stderr)
+    default:
+        if useVM {
+            return runCompiled(name,src,stderr)
+        }
+        return runProgram(name,src,stderr)
+    }
+}
+
+// the file name used in positions and the contents of path, - is standard input
+func readSource(path string, stdin io.Reader) (string,string,error) {
+    if path=="-" {
+        src,err:=io.ReadAll(stdin)
+        if err!=nil {
+            return "","",fmt.Errorf("reading standard input: %w",err)
+        }
+        return "<stdin>",string(src),nil
+    }
+    src,err:=os.ReadFile(path)
+    if err!=nil {
+        return "","",err
+    }
+    return path,string(src),nil
+}
+
+// every token is printed, ILLEGAL ones too, and what the lexer found wrong is
+// rendered to errOut after the dump like the other commands render syntax errors
+func dumpTokens(name,src string, out,errOut io.Writer) int {
+    l:=lexer.NewFile(name,src,lexer.WithComments())
+    for {
+        tok:=l.NextToken()
+        fmt.Fprintf(out,"%-16s %-10s %q\n",tok.Pos,tok.Type,tok.Value)
+        if tok.Type==token.EOF {
+            break
+        }
+    }
+    if len(l.Errors())==0 {
+        return exitOK
+    }
+    for _,err:=range l.Errors() {
+        diag.Render(errOut,src,diag.Diagnostic{Code: err.Code,Severity: diag.Error,Message: err.Msg,Span: diag.Span{Start: err.Pos,End: err.End}})
+    }
+    return exitSyntax
+}
+
+// parses src, rendering any diagnostics to errOut. The program is nil if it did not parse
+func parse(name,src string, errOut io.Writer) *ast.Program {
+    p:=parser.New(lexer.NewFile(name,src))
+    program:=p.ParseProgram()
+    if len(p.Diagnostics())!=0 {
+        diag.RenderAll(errOut,src,p.Diagnostics())
+        return nil
+    }
+    return program
+}
+
+func dumpAST(name,src string, out,errOut io.Writer) int {
+    program:=parse(name,src,errOut)
+    if program==nil {
+        return exitSyntax
     }
-    defer file.Close()
-    repl.Start(file,os.Stdout)
+    ast.Fprint(out,program)
+    return exitOK
+}
+
+func runProgram(name,src string, errOut io.Writer) int {
+    program:=parse(name,src,errOut)
+    if program==nil {
+        return exitSyntax
+    }
+    result:=evaluator.Eval(program,object.NewEnvironment())
+    if errObj,ok:=result.(*object.Error);ok {
+        fmt.Fprintf(errOut,"runtime error: %s\n",errObj.Message)
+        return exitRuntime
+    }
+    return exitOK
+}
+
+// compiles src, rendering parse diagnostics and printing compile errors to errOut.
+// The bytecode is nil if either failed
+func compile(name,src string, errOut io.Writer) *compiler.Bytecode {
+    program:=parse(name,src,errOut)
+    if program==nil {
+        return nil
+    }
+    comp:=compiler.New()
+    if err:=comp.Compile(program);err!=nil {
+        fmt.Fprintf(errOut,"compile error: %s\n",err)
+        return nil
+    }
+    return comp.Bytecode()
+}
+
+// like runProgram but on the vm. Names that are not defined are found by the compiler,
+// before anything runs
+func runCompiled(name,src string, errOut io.Writer) int {
+    bytecode:=compile(name,src,errOut)
+    if bytecode==nil {
+        return exitSyntax
+    }
+    return runVM(bytecode,errOut)
+}
+
+func runVM(bytecode *compiler.Bytecode, errOut io.Writer) int {
+    machine:=vm.New(bytecode)
+    if err:=machine.Run();err!=nil {
+        fmt.Fprintf(errOut,"runtime error: %s\n",err)
+        return exitRuntime
+    }
+    return exitOK
+}
+
+// loads a file written by build, nil if it fails validation
+func load(name string, data []byte, errOut io.Writer) *compiler.Bytecode {
+    bytecode:=&compiler.Bytecode{}
+    if err:=bytecode.UnmarshalBinary(data);err!=nil {
+        fmt.Fprintf(errOut,"monkey: loading %s: %v\n",name,err)
+        return nil
+    }
+    return bytecode
+}
 
+// a file that fails validation is not run at all
+func runBytecode(name string, data []byte, errOut io.Writer) int {
+    bytecode:=load(name,data,errOut)
+    if bytecode==nil {
+        return exitUsage
+    }
+    return runVM(bytecode,errOut)
+}
+
+func disassemble(name,src string, out,errOut io.Writer) int {
+    bytecode:=compile(name,src,errOut)
+    if bytecode==nil {
+        return exitSyntax
+    }
+    return printListing(bytecode,out,errOut)
+}
+
+func disassembleBytecode(name string, data []byte, out,errOut io.Writer) int {
+    bytecode:=load(name,data,errOut)
+    if bytecode==nil {
+        return exitUsage
+    }
+    return printListing(bytecode,out,errOut)
+}
+
+func printListing(bytecode *compiler.Bytecode, out,errOut io.Writer) int {
+    if err:=disasm.Fprint(out,bytecode);err!=nil {
+        fmt.Fprintf(errOut,"monkey: %v\n",err)
+        return exitUsage
+    }
+    return exitOK
+}
+
+func buildProgram(name,src,out string, strip bool, errOut io.Writer) int {
+    bytecode:=compile(name,src,errOut)
+    if bytecode==nil {
+        return exitSyntax
+    }
+    if strip {
+        bytecode.StripDebug()
+    }
+    data,err:=bytecode.MarshalBinary()
+    if err==nil {
+        err=os.WriteFile(out,data,0o644)
+    }
+    if err!=nil {
+        fmt.Fprintf(errOut,"monkey: %v\n",err)
+        return exitUsage
+    }
+    return exitOK
 }
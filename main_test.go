@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, src string) string {
+	path:=filepath.Join(t.TempDir(),"script.monkey")
+	if err:=os.WriteFile(path,[]byte(src),0o644);err!=nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExitCodes(t *testing.T) {
+	tests:=[]struct{
+		args []string
+		src string
+		code int
+		stderr string
+	}{
+		{[]string{"run"},"let x = 1;",exitOK,""},
+		{[]string{"run"},"let x = ;",exitSyntax,"error[E0002]"},
+		{[]string{"run"},"let x = 1 + true;",exitRuntime,"runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"ast"},"let x = ;",exitSyntax,"script.monkey:1:9"},
+		{[]string{"run","-vm"},"let x = 1;",exitOK,""},
+		{[]string{"run","-vm"},"let x = 1 + true;",exitRuntime,"runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run","-vm"},"let x = y;",exitSyntax,"compile error: "},
+		{[]string{"frobnicate"},"",exitUsage,"unknown command"},
+	}
+
+	for _,tt:=range tests {
+		args:=append(tt.args,writeScript(t,tt.src))
+		var stdout,stderr bytes.Buffer
+		code:=run(args,strings.NewReader(""),&stdout,&stderr)
+		if code!=tt.code {
+			t.Errorf("%v: expected exit code %d got %d (stderr %q)",tt.args,tt.code,code,stderr.String())
+		}
+		if !strings.Contains(stderr.String(),tt.stderr) {
+			t.Errorf("%v: expected stderr to contain %q got %q",tt.args,tt.stderr,stderr.String())
+		}
+	}
+}
+
+func TestRunPrintsToStdout(t *testing.T) {
+	path:=writeScript(t,`puts("hi", 1 + 1);`)
+	for _,args:=range [][]string{{"run",path},{"run","-vm",path}} {
+		var stdout,stderr bytes.Buffer
+		if code:=run(args,strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+			t.Fatalf("%v: expected exit code 0 got %d (%s)",args,code,stderr.String())
+		}
+		if stdout.String()!="hi\n2\n" {
+			t.Errorf("%v: expected puts to write to stdout, got %q",args,stdout.String())
+		}
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	var stdout,stderr bytes.Buffer
+	code:=run([]string{"run",filepath.Join(t.TempDir(),"nope.monkey")},strings.NewReader(""),&stdout,&stderr)
+	if code!=exitUsage {
+		t.Errorf("Expected exit code %d got %d",exitUsage,code)
+	}
+}
+
+func TestTokensFromStdin(t *testing.T) {
+	var stdout,stderr bytes.Buffer
+	code:=run([]string{"tokens","-"},strings.NewReader("let x"),&stdout,&stderr)
+	if code!=exitOK {
+		t.Fatalf("Expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+
+	lines:=strings.Split(strings.TrimSpace(stdout.String()),"\n")
+	if len(lines)!=3 {
+		t.Fatalf("Expected 3 tokens got %q",stdout.String())
+	}
+	if !strings.HasPrefix(lines[1],"<stdin>:1:5") || !strings.Contains(lines[1],`"x"`) {
+		t.Errorf("Unexpected token line %q",lines[1])
+	}
+	if !strings.Contains(lines[2],"EOF") {
+		t.Errorf("Expected the dump to end with EOF got %q",lines[2])
+	}
+}
+
+func TestTokensWithErrors(t *testing.T) {
+	var stdout,stderr bytes.Buffer
+	code:=run([]string{"tokens","-"},strings.NewReader("let s = \"abc"),&stdout,&stderr)
+	if code!=exitSyntax {
+		t.Errorf("Expected exit code %d got %d",exitSyntax,code)
+	}
+	if !strings.Contains(stdout.String(),"ILLEGAL") || !strings.Contains(stdout.String(),"EOF") {
+		t.Errorf("Expected the whole dump despite the error, got %q",stdout.String())
+	}
+	if !strings.Contains(stderr.String(),"error[") || !strings.Contains(stderr.String(),"<stdin>:1:9") {
+		t.Errorf("Expected the lexer error on stderr, got %q",stderr.String())
+	}
+}
+
+func TestBuildAndRunCompiled(t *testing.T) {
+	path:=writeScript(t,`let f = fn(x) { x * 2 }; f(21); first([]) + 1;`)
+
+	var stdout,stderr bytes.Buffer
+	if code:=run([]string{"build",path},strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+		t.Fatalf("build: expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+	compiled:=strings.TrimSuffix(path,".monkey")+".mkc"
+
+	// the program fails at runtime, which only happens once the file has loaded fine
+	code:=run([]string{"run",compiled},strings.NewReader(""),&stdout,&stderr)
+	if code!=exitRuntime || !strings.Contains(stderr.String(),"runtime error: type mismatch: NULL + INTEGER") {
+		t.Errorf("run: expected a runtime error got exit code %d (%s)",code,stderr.String())
+	}
+
+	stderr.Reset()
+	if code:=run([]string{"tokens",compiled},strings.NewReader(""),&stdout,&stderr);code!=exitUsage {
+		t.Errorf("tokens: expected exit code %d got %d",exitUsage,code)
+	}
+
+	data,err:=os.ReadFile(compiled)
+	if err!=nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code=run([]string{"run","-"},bytes.NewReader(data[:len(data)/2]),&stdout,&stderr)
+	if code!=exitUsage || !strings.Contains(stderr.String(),"truncated file") {
+		t.Errorf("run: expected a truncated file to be rejected got exit code %d (%s)",code,stderr.String())
+	}
+}
+
+func TestBuildFlags(t *testing.T) {
+	path:=writeScript(t,"1")
+	out:=filepath.Join(t.TempDir(),"out.mkc")
+
+	var stdout,stderr bytes.Buffer
+	if code:=run([]string{"build","-o",out,"-strip",path},strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+		t.Fatalf("build: expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+	if _,err:=os.Stat(out);err!=nil {
+		t.Errorf("Expected %s to be written: %v",out,err)
+	}
+
+	if code:=run([]string{"build","-"},strings.NewReader("1"),&stdout,&stderr);code!=exitUsage {
+		t.Errorf("Expected build from stdin without -o to fail got %d",code)
+	}
+	if code:=run([]string{"run","-strip",path},strings.NewReader(""),&stdout,&stderr);code!=exitUsage {
+		t.Errorf("Expected -strip to be rejected by run got %d",code)
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	path:=writeScript(t,"let x = 1;")
+
+	var stdout,stderr bytes.Buffer
+	if code:=run([]string{"disasm",path},strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+		t.Fatalf("disasm: expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+	source:=stdout.String()
+	if !strings.Contains(source,"1:9   OpConstant 0        ; 1") {
+		t.Errorf("Unexpected listing %q",source)
+	}
+
+	// a compiled file lists the same, as long as it kept its line table
+	if code:=run([]string{"build",path},strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+		t.Fatalf("build: expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+	stdout.Reset()
+	compiled:=strings.TrimSuffix(path,".monkey")+".mkc"
+	if code:=run([]string{"disasm",compiled},strings.NewReader(""),&stdout,&stderr);code!=exitOK {
+		t.Fatalf("disasm: expected exit code 0 got %d (%s)",code,stderr.String())
+	}
+	if stdout.String()!=source {
+		t.Errorf("Expected the compiled listing to match\n%s\ngot\n%s",source,stdout.String())
+	}
+}
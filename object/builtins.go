@@ -0,0 +1,205 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// where puts writes, tests and embedders can point it elsewhere
+var Output io.Writer=os.Stdout
+
+// the body of a builtin. The arguments have already been checked against the
+// declared params, returning nil means null
+type BuiltinFunction func(args ...Object) Object
+
+// Param describes one argument of a builtin
+type Param struct {
+	Name string
+	Types []ObjectType // the accepted types, empty accepts anything
+}
+
+// Builtin is a function provided by the host rather than written in Monkey.
+// Calls are checked against Params before Fn runs, mismatches become error values
+type Builtin struct {
+	Name string
+	Params []Param
+	Variadic bool // the last param may be passed any number of times, including none
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return BUILTIN_OBJ
+}
+
+func (b *Builtin) Inspect() string {
+	return "builtin function "+b.Name
+}
+
+// Call checks the arity and argument types and then runs the builtin
+func (b *Builtin) Call(args ...Object) Object {
+	if err:=b.checkArgs(args);err!=nil {
+		return err
+	}
+	return b.Fn(args...)
+}
+
+func (b *Builtin) checkArgs(args []Object) *Error {
+	required:=len(b.Params)
+	if b.Variadic {
+		required--
+	}
+	if len(args)<required || (!b.Variadic && len(args)>required) {
+		want:=fmt.Sprintf("%d",required)
+		if b.Variadic {
+			want=fmt.Sprintf("at least %d",required)
+		}
+		return &Error{Message: fmt.Sprintf("wrong number of arguments to `%s`: want=%s, got=%d",b.Name,want,len(args))}
+	}
+
+	for i,arg:=range args {
+		param:=b.Params[len(b.Params)-1]
+		if i<len(b.Params) {
+			param=b.Params[i]
+		}
+		if !accepts(param,arg) {
+			return &Error{Message: fmt.Sprintf("argument %d (%s) to `%s` must be %s, got %s",
+				i+1,param.Name,b.Name,joinTypes(param.Types),TypeOf(arg))}
+		}
+	}
+	return nil
+}
+
+func accepts(param Param, arg Object) bool {
+	if len(param.Types)==0 {
+		return true
+	}
+	for _,t:=range param.Types {
+		if TypeOf(arg)==t {
+			return true
+		}
+	}
+	return false
+}
+
+func joinTypes(types []ObjectType) string {
+	names:=make([]string,len(types))
+	for i,t:=range types {
+		names[i]=string(t)
+	}
+	return strings.Join(names," or ")
+}
+
+var (
+	builtins=map[string]*Builtin{}
+	builtinOrder []*Builtin
+)
+
+// RegisterBuiltin makes b callable from Monkey code under b.Name. Builtins are
+// looked up after the user's bindings, so a let of the same name shadows them.
+// It panics on a duplicate name and on a variadic builtin without a param to repeat,
+// registration is meant to happen in init functions
+func RegisterBuiltin(b *Builtin) {
+	if b.Variadic && len(b.Params)==0 {
+		panic(fmt.Sprintf("builtin %q is variadic but has no params",b.Name))
+	}
+	if _,ok:=builtins[b.Name];ok {
+		panic(fmt.Sprintf("builtin %q registered twice",b.Name))
+	}
+	builtins[b.Name]=b
+	builtinOrder = append(builtinOrder, b)
+}
+
+func LookupBuiltin(name string) (*Builtin,bool) {
+	b,ok:=builtins[name]
+	return b,ok
+}
+
+// all builtins in registration order
+func Builtins() []*Builtin {
+	return builtinOrder
+}
+
+func init() {
+	RegisterBuiltin(&Builtin{
+		Name: "len",
+		Params: []Param{{Name: "value",Types: []ObjectType{STRING_OBJ,ARRAY_OBJ,HASH_OBJ}}},
+		Fn: func(args ...Object) Object {
+			switch arg:=args[0].(type) {
+			case *String: // counts characters, not bytes
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Hash:
+				return &Integer{Value: int64(arg.Len())}
+			}
+			return nil
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name: "first",
+		Params: []Param{{Name: "array",Types: []ObjectType{ARRAY_OBJ}}},
+		Fn: func(args ...Object) Object {
+			elements:=args[0].(*Array).Elements
+			if len(elements)==0 {
+				return nil
+			}
+			return elements[0]
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name: "last",
+		Params: []Param{{Name: "array",Types: []ObjectType{ARRAY_OBJ}}},
+		Fn: func(args ...Object) Object {
+			elements:=args[0].(*Array).Elements
+			if len(elements)==0 {
+				return nil
+			}
+			return elements[len(elements)-1]
+		},
+	})
+
+	// a new array without the first element, the argument is left alone
+	RegisterBuiltin(&Builtin{
+		Name: "rest",
+		Params: []Param{{Name: "array",Types: []ObjectType{ARRAY_OBJ}}},
+		Fn: func(args ...Object) Object {
+			elements:=args[0].(*Array).Elements
+			if len(elements)==0 {
+				return nil
+			}
+			rest:=make([]Object,len(elements)-1)
+			copy(rest,elements[1:])
+			return &Array{Elements: rest}
+		},
+	})
+
+	// a new array with value appended, the argument is left alone
+	RegisterBuiltin(&Builtin{
+		Name: "push",
+		Params: []Param{{Name: "array",Types: []ObjectType{ARRAY_OBJ}},{Name: "value"}},
+		Fn: func(args ...Object) Object {
+			elements:=args[0].(*Array).Elements
+			pushed:=make([]Object,len(elements)+1)
+			copy(pushed,elements)
+			pushed[len(elements)]=args[1]
+			return &Array{Elements: pushed}
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name: "puts",
+		Params: []Param{{Name: "values"}},
+		Variadic: true,
+		Fn: func(args ...Object) Object {
+			for _,arg:=range args {
+				fmt.Fprintln(Output,arg.Inspect())
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,69 @@
+package object
+
+import "sort"
+
+// Environment maps names to values. Function calls get a fresh environment
+// enclosed by the one the function was defined in, lookups fall through to outer
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{
+		store: make(map[string]Object),
+	}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env:=NewEnvironment()
+	env.outer=outer
+	return env
+}
+
+func (e *Environment) Get(name string) (Object,bool) {
+	obj,ok:=e.store[name]
+	if !ok && e.outer!=nil {
+		return e.outer.Get(name)
+	}
+	return obj,ok
+}
+
+// binds name in this environment, shadowing any outer binding
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name]=val
+	return val
+}
+
+// Assign rebinds name in the nearest scope that binds it, unlike Set it never
+// creates a binding. It reports false when no scope binds name
+func (e *Environment) Assign(name string, val Object) bool {
+	for env:=e;env!=nil;env=env.outer {
+		if _,ok:=env.store[name];ok {
+			env.store[name]=val
+			return true
+		}
+	}
+	return false
+}
+
+// the scope this one is enclosed by, nil for the global environment
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// like Get but does not look at outer scopes
+func (e *Environment) GetLocal(name string) (Object,bool) {
+	obj,ok:=e.store[name]
+	return obj,ok
+}
+
+// the names bound directly in this scope, sorted
+func (e *Environment) Names() []string {
+	names:=make([]string,0,len(e.store))
+	for name:=range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
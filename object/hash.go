@@ -0,0 +1,124 @@
+package object
+
+import (
+	"bytes"
+	"hash/fnv"
+	"strings"
+)
+
+// HashKey identifies a hash key by type and a hash of its value. Integers and
+// booleans get a HashKey of their own, strings are hashed with FNV-1a so the
+// value does not change between runs, and two strings can share one. A Hash
+// compares the keys themselves when they do
+type HashKey struct {
+	Type ObjectType
+	Value uint64
+}
+
+// values that can be used as hash keys, only integers, booleans and strings
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(),Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value=1
+	}
+	return HashKey{Type: b.Type(),Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h:=fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(),Value: h.Sum64()}
+}
+
+// the original key is kept next to the value so the hash can be printed and iterated
+type HashPair struct {
+	Key Object
+	Value Object
+}
+
+// Hash remembers the order keys were first inserted in, printing and iterating follow it
+type Hash struct {
+	buckets map[HashKey][]int // where in pairs the keys with a HashKey are, more than one only if they collide
+	pairs []HashPair
+}
+
+func NewHash() *Hash {
+	return &Hash{buckets: make(map[HashKey][]int)}
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+func (h *Hash) Inspect() string {
+	var buf bytes.Buffer
+	pairs:=[]string{}
+	for _,pair:=range h.Pairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	buf.WriteString("{")
+	buf.WriteString(strings.Join(pairs,", "))
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// binds key to value, replacing the value of an existing key in place
+func (h *Hash) Set(key Hashable, value Object) {
+	hk:=key.HashKey()
+	if i,ok:=h.find(hk,key);ok {
+		h.pairs[i].Value=value
+		return
+	}
+	h.buckets[hk] = append(h.buckets[hk], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key,Value: value})
+}
+
+func (h *Hash) Get(key Hashable) (Object,bool) {
+	if i,ok:=h.find(key.HashKey(),key);ok {
+		return h.pairs[i].Value,true
+	}
+	return nil,false
+}
+
+// the index in pairs of the key equal to key among those with its HashKey
+func (h *Hash) find(hk HashKey, key Hashable) (int,bool) {
+	for _,i:=range h.buckets[hk] {
+		if sameKey(h.pairs[i].Key,key) {
+			return i,true
+		}
+	}
+	return 0,false
+}
+
+// keys with the same HashKey are compared by value, integers and booleans never
+// collide but any other Hashable is told apart by how it prints
+func sameKey(a Object, b Hashable) bool {
+	switch a:=a.(type) {
+	case *String:
+		b,ok:=b.(*String)
+		return ok && a.Value==b.Value
+	case *Integer,*Boolean:
+		return a.Type()==b.Type()
+	}
+	return a.Type()==b.Type() && a.Inspect()==b.Inspect()
+}
+
+func (h *Hash) Len() int {
+	return len(h.pairs)
+}
+
+// the pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs:=make([]HashPair,len(h.pairs))
+	copy(pairs,h.pairs)
+	return pairs
+}
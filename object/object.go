@@ -0,0 +1,284 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/code"
+)
+
+// ObjectType is the type tag every value carries. Host code can switch on
+// obj.Type() against the constants below instead of type asserting
+type ObjectType string
+
+const (
+	INTEGER_OBJ ObjectType="INTEGER"
+	BOOLEAN_OBJ ObjectType="BOOLEAN"
+	NULL_OBJ ObjectType="NULL"
+	RETURN_VALUE_OBJ ObjectType="RETURN_VALUE"
+	ERROR_OBJ ObjectType="ERROR"
+	FUNCTION_OBJ ObjectType="FUNCTION"
+	STRING_OBJ ObjectType="STRING"
+	ARRAY_OBJ ObjectType="ARRAY"
+	HASH_OBJ ObjectType="HASH"
+	BUILTIN_OBJ ObjectType="BUILTIN"
+	COMPILED_FUNCTION_OBJ ObjectType="COMPILED_FUNCTION"
+	CLOSURE_OBJ ObjectType="CLOSURE"
+	BREAK_OBJ ObjectType="BREAK"
+	CONTINUE_OBJ ObjectType="CONTINUE"
+	CELL_OBJ ObjectType="CELL"
+)
+
+// there is only ever one true, one false and one null so that they can be compared
+// by pointer, code creating values should use these rather than new instances
+var (
+	NULL=&Null{}
+	TRUE=&Boolean{Value: true}
+	FALSE=&Boolean{Value: false}
+	BREAK=&Break{}
+	CONTINUE=&Continue{}
+)
+
+func NativeBoolToObject(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+// TypeOf is obj.Type() that also accepts a nil Go value, which it reports as NULL
+func TypeOf(obj Object) ObjectType {
+	if obj==nil {
+		return NULL_OBJ
+	}
+	return obj.Type()
+}
+
+// Is reports whether obj carries the type tag t
+func Is(obj Object, t ObjectType) bool {
+	return TypeOf(obj)==t
+}
+
+// Items gives the values a for-in loop goes through, the elements of an array or the
+// keys of a hash in insertion order. They are copied out before the first iteration
+// so the loop body changing the collection does not change the loop. ok is false
+// for values that cannot be iterated over
+func Items(obj Object) (items []Object, ok bool) {
+	switch obj:=obj.(type) {
+	case *Array:
+		return append([]Object{},obj.Elements...),true
+	case *Hash:
+		for _,pair:=range obj.Pairs() {
+			items = append(items, pair.Key)
+		}
+		return items,true
+	}
+	return nil,false
+}
+
+// every value the evaluator produces is an Object
+type Object interface {
+	Type() ObjectType
+	Inspect() string // to print out values
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType {
+	return INTEGER_OBJ
+}
+
+func (i *Integer) Inspect() string {
+	return fmt.Sprintf("%d",i.Value)
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType {
+	return BOOLEAN_OBJ
+}
+
+func (b *Boolean) Inspect() string {
+	return fmt.Sprintf("%t",b.Value)
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType {
+	return ARRAY_OBJ
+}
+
+func (a *Array) Inspect() string {
+	var buf bytes.Buffer
+	elements:=[]string{}
+	for _,e:=range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	buf.WriteString("[")
+	buf.WriteString(strings.Join(elements,", "))
+	buf.WriteString("]")
+	return buf.String()
+}
+
+// represents the absence of a value, like an if without an else whose condition was false
+type Null struct{}
+
+func (n *Null) Type() ObjectType {
+	return NULL_OBJ
+}
+
+func (n *Null) Inspect() string {
+	return "null"
+}
+
+// wraps the value of a return statement so that it can bubble up through nested blocks
+// until it reaches the function call (or the program) that should unwrap it
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType {
+	return RETURN_VALUE_OBJ
+}
+
+func (rv *ReturnValue) Inspect() string {
+	return rv.Value.Inspect()
+}
+
+// break and continue send these up through the blocks of an if to the loop they
+// act on, the way a return value travels up to its function
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// runtime errors are values, they stop evaluation the same way a return value does
+type Error struct {
+	Message string
+}
+
+func (e *Error) Type() ObjectType {
+	return ERROR_OBJ
+}
+
+func (e *Error) Inspect() string {
+	return "ERROR: "+e.Message
+}
+
+// Function is a closure: besides its code it keeps a pointer to the environment
+// it was defined in, so names free in Body resolve there even after the
+// defining call has returned
+type Function struct {
+	Params []*ast.Identifier
+	Body *ast.BlockStmt
+	Env *Environment
+}
+
+func (f *Function) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (f *Function) Inspect() string {
+	var buf bytes.Buffer
+	params:=[]string{}
+	for _,p:=range f.Params {
+		params = append(params, p.String())
+	}
+	buf.WriteString("fn(")
+	buf.WriteString(strings.Join(params,", "))
+	buf.WriteString(") ")
+	buf.WriteString(f.Body.String())
+	return buf.String()
+}
+
+// CompiledFunction is a function literal after the compiler is done with it,
+// the vm runs Instructions in a frame with room for NumLocals locals, the
+// parameters being the first NumParameters of them. The locals listed in Cells
+// are shared with closures and hold a Cell. Lines is nil when the function was
+// loaded without debug information
+type CompiledFunction struct {
+	Instructions code.Instructions
+	NumLocals int
+	NumParameters int
+	Cells []int
+	Lines code.LineTable
+
+	// the names of the locals by slot and of the free variables by index, for
+	// the error when one is read before anything was bound to it
+	LocalNames []string
+	FreeNames []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]",cf)
+}
+
+// Cell holds a local that is assigned to and used by a closure, the function and
+// its closures all refer to the cell instead of copying the value, so they see
+// each other's assignments. Only the vm creates cells, programs never see one
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
+func (c *Cell) Inspect() string {
+	return "cell("+c.Value.Inspect()+")"
+}
+
+// Closure is what the vm makes of a function literal: the compiled function
+// together with copies of the values it uses from enclosing functions, taken
+// when the literal was evaluated. A variable in a Cell is copied as the cell
+type Closure struct {
+	Fn *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return CLOSURE_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]",c)
+}
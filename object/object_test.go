@@ -0,0 +1,170 @@
+package object
+
+import "testing"
+
+func TestEnclosedEnvironment(t *testing.T) {
+	outer:=NewEnvironment()
+	outer.Set("x",&Integer{Value: 1})
+	outer.Set("y",&Integer{Value: 2})
+
+	inner:=NewEnclosedEnvironment(outer)
+	inner.Set("x",&Integer{Value: 10})
+
+	if inner.Outer()!=outer {
+		t.Fatalf("inner.Outer() is not the enclosing environment")
+	}
+
+	x,ok:=inner.Get("x")
+	if !ok || x.(*Integer).Value!=10 {
+		t.Errorf("Expected inner x to shadow outer x, got %v",x)
+	}
+
+	y,ok:=inner.Get("y")
+	if !ok || y.(*Integer).Value!=2 {
+		t.Errorf("Expected y to resolve in the outer scope, got %v",y)
+	}
+
+	if _,ok:=inner.GetLocal("y");ok {
+		t.Errorf("GetLocal should not look at outer scopes")
+	}
+
+	x,_=outer.Get("x")
+	if x.(*Integer).Value!=1 {
+		t.Errorf("Setting x in the inner scope changed the outer x to %v",x)
+	}
+
+	names:=outer.Names()
+	if len(names)!=2 || names[0]!="x" || names[1]!="y" {
+		t.Errorf("Expected names [x y] got %v",names)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	tests:=[]struct{
+		obj Object
+		expected ObjectType
+	}{
+		{&Integer{Value: 1},INTEGER_OBJ},
+		{&Boolean{Value: true},BOOLEAN_OBJ},
+		{&Null{},NULL_OBJ},
+		{nil,NULL_OBJ},
+		{&Error{Message: "boom"},ERROR_OBJ},
+		{&ReturnValue{Value: &Integer{Value: 1}},RETURN_VALUE_OBJ},
+		{&Function{Env: NewEnvironment()},FUNCTION_OBJ},
+	}
+
+	for _,tt:=range tests {
+		if TypeOf(tt.obj)!=tt.expected {
+			t.Errorf("Expected type %s got %s",tt.expected,TypeOf(tt.obj))
+		}
+		if !Is(tt.obj,tt.expected) {
+			t.Errorf("Is(%v, %s) returned false",tt.obj,tt.expected)
+		}
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	hello1:=&String{Value: "Hello World"}
+	hello2:=&String{Value: "Hello World"}
+	diff:=&String{Value: "My name is johnny"}
+
+	if hello1.HashKey()!=hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey()==diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+
+	one:=&Integer{Value: 1}
+	if one.HashKey()==(&Boolean{Value: true}).HashKey() {
+		t.Errorf("1 and true share a hash key")
+	}
+	if (&String{Value: ""}).HashKey()!=(&String{Value: ""}).HashKey() {
+		t.Errorf("empty strings have different hash keys")
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	h:=NewHash()
+	h.Set(&String{Value: "b"},&Integer{Value: 1})
+	h.Set(&Integer{Value: 7},&Integer{Value: 2})
+	h.Set(&String{Value: "b"},&Integer{Value: 3})
+	h.Set(&Boolean{Value: false},&Integer{Value: 4})
+
+	if h.Len()!=3 {
+		t.Fatalf("Expected 3 pairs got %d",h.Len())
+	}
+	if h.Inspect()!="{b: 3, 7: 2, false: 4}" {
+		t.Errorf("Unexpected Inspect() %q",h.Inspect())
+	}
+	value,ok:=h.Get(&String{Value: "b"})
+	if !ok || value.(*Integer).Value!=3 {
+		t.Errorf("Expected b to map to 3 got %v",value)
+	}
+	if _,ok:=h.Get(&String{Value: "c"});ok {
+		t.Errorf("Found a key that was never set")
+	}
+}
+
+// stands in for strings whose FNV-1a hashes collide, every value gets the same HashKey
+type collidingString struct {
+	*String
+}
+
+func (c collidingString) HashKey() HashKey {
+	return HashKey{Type: STRING_OBJ,Value: 42}
+}
+
+func TestHashKeysThatCollide(t *testing.T) {
+	h:=NewHash()
+	h.Set(collidingString{&String{Value: "a"}},&Integer{Value: 1})
+	h.Set(collidingString{&String{Value: "b"}},&Integer{Value: 2})
+	h.Set(collidingString{&String{Value: "a"}},&Integer{Value: 3})
+
+	if h.Len()!=2 {
+		t.Fatalf("Expected 2 pairs got %d (%s)",h.Len(),h.Inspect())
+	}
+	for key,want:=range map[string]int64{"a": 3,"b": 2} {
+		value,ok:=h.Get(collidingString{&String{Value: key}})
+		if !ok || value.(*Integer).Value!=want {
+			t.Errorf("Expected %s to map to %d got %v",key,want,value)
+		}
+	}
+	if _,ok:=h.Get(collidingString{&String{Value: "c"}});ok {
+		t.Errorf("Found a key that only shares a HashKey with the ones set")
+	}
+}
+
+func TestAssign(t *testing.T) {
+	outer:=NewEnvironment()
+	outer.Set("x",&Integer{Value: 1})
+	inner:=NewEnclosedEnvironment(outer)
+
+	if !inner.Assign("x",&Integer{Value: 2}) {
+		t.Fatalf("Assign did not find x in the outer scope")
+	}
+	if _,ok:=inner.GetLocal("x");ok {
+		t.Errorf("Assign created a binding in the inner scope")
+	}
+	if x,_:=outer.Get("x");x.(*Integer).Value!=2 {
+		t.Errorf("Expected the outer x to be 2 got %v",x)
+	}
+	if inner.Assign("y",&Integer{Value: 3}) {
+		t.Errorf("Assign to an unbound name should fail")
+	}
+	if _,ok:=inner.Get("y");ok {
+		t.Errorf("A failed Assign bound y")
+	}
+}
+
+func TestRegisterVariadicWithoutParams(t *testing.T) {
+	defer func() {
+		if recover()==nil {
+			t.Errorf("Expected a variadic builtin without params to be rejected")
+		}
+		if _,ok:=LookupBuiltin("noparams");ok {
+			t.Errorf("Expected the rejected builtin not to be registered")
+		}
+	}()
+	RegisterBuiltin(&Builtin{Name: "noparams",Variadic: true,Fn: func(args ...Object) Object { return nil }})
+}
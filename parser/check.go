@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/diag"
+	"github.com/Sumz-K/Go-Interpreter/token"
+)
+
+// KeepConsts carries consts over between programs, the way a repl keeps its
+// bindings between inputs. The program p parses is checked against the top level
+// consts in consts, and if it has no errors its own are added to them
+func (p *Parser) KeepConsts(consts map[string]token.Position) {
+	p.consts=consts
+}
+
+// a scope as the evaluator has them, the top level or a function body. Blocks
+// and loops do not get one
+type constScope struct {
+	outer *constScope
+	declared map[string]bool // name is bound so far, true for a const
+	declaredAt map[string]token.Position
+	consts map[string]token.Position // every const of the scope, also those further down
+	bound map[string]bool // every name the scope binds
+}
+
+func newConstScope(outer *constScope, body ast.Node) *constScope {
+	s:=&constScope{
+		outer: outer,
+		declared: map[string]bool{},
+		declaredAt: map[string]token.Position{},
+		consts: map[string]token.Position{},
+		bound: map[string]bool{},
+	}
+	ast.Inspect(body,func(node ast.Node) bool {
+		switch node:=node.(type) {
+		case *ast.LetStmt:
+			s.bound[node.Name.Value]=true
+			if _,ok:=s.consts[node.Name.Value];node.IsConst() && !ok {
+				s.consts[node.Name.Value]=node.Name.Pos()
+			}
+		case *ast.ForInStmt:
+			s.bound[node.Variable.Value]=true
+		case *ast.Function:
+			return false
+		}
+		return true
+	})
+	return s
+}
+
+func (s *constScope) declare(name string, isConst bool, pos token.Position) {
+	s.declared[name]=isConst
+	s.declaredAt[name]=pos
+	s.bound[name]=true
+	if _,ok:=s.consts[name];isConst && !ok {
+		s.consts[name]=pos
+	}
+}
+
+// checkConsts reports assignments to a const and lets, consts and for-in loops
+// that bind a const's name again in its scope. A nested function can be called
+// at any time, so an assignment in it is an error if the scope it assigns in has
+// a const of that name anywhere, not only before the function. Loop bodies do not
+// get a scope, so a const in one would be bound again by the next iteration, and
+// an assignment before it would change it. Consts are not allowed there at all,
+// a function called in the loop has a body of its own and may have them
+func (p *Parser) checkConsts(program *ast.Program) {
+	scope:=newConstScope(nil,program)
+	for name,pos:=range p.consts {
+		scope.declare(name,true,pos)
+	}
+	found:=len(p.diagnostics)
+	loops:=0 // how many loops of the current function the node is repeated by
+
+	var visit func(ast.Node) bool
+	inLoop:=func(node ast.Node) {
+		loops++
+		ast.Inspect(node,visit)
+		loops--
+	}
+	visit=func(node ast.Node) bool {
+		switch node:=node.(type) {
+		case *ast.LetStmt:
+			ast.Inspect(node.Value,visit)
+			if node.IsConst() && loops>0 {
+				p.constInLoop(node.Name)
+			}
+			p.checkBinding(scope,node.Name)
+			scope.declare(node.Name.Value,node.IsConst(),node.Name.Pos())
+			return false
+		case *ast.ForInStmt:
+			ast.Inspect(node.Iterable,visit)
+			p.checkBinding(scope,node.Variable)
+			scope.declare(node.Variable.Value,false,node.Variable.Pos())
+			inLoop(node.Body)
+			return false
+		case *ast.WhileStmt:
+			inLoop(node.Condition)
+			inLoop(node.Body)
+			return false
+		case *ast.ForStmt:
+			ast.Inspect(node.Init,visit)
+			inLoop(node.Condition)
+			inLoop(node.Body)
+			inLoop(node.Post)
+			return false
+		case *ast.AssignExpression:
+			if ident,ok:=node.Target.(*ast.Identifier);ok {
+				ast.Inspect(node.Value,visit)
+				p.checkAssign(scope,ident)
+				return false
+			}
+		case *ast.Function:
+			scope=newConstScope(scope,node.Body)
+			for _,param:=range node.Params {
+				scope.declare(param.Value,false,param.Pos())
+			}
+			outerLoops:=loops
+			loops=0
+			ast.Inspect(node.Body,visit)
+			loops=outerLoops
+			scope=scope.outer
+			return false
+		}
+		return true
+	}
+	for _,stmt:=range program.Statements {
+		ast.Inspect(stmt,visit)
+	}
+
+	if p.consts!=nil && len(p.diagnostics)==found {
+		for name,isConst:=range scope.declared {
+			if isConst {
+				p.consts[name]=scope.declaredAt[name]
+			}
+		}
+	}
+}
+
+// name is about to be bound in scope, which it may not be if it is a const there already
+func (p *Parser) checkBinding(scope *constScope, name *ast.Identifier) {
+	if isConst,ok:=scope.declared[name.Value];ok && isConst {
+		p.diagnostics = append(p.diagnostics, diag.Diagnostic{
+			Code: ErrRedeclareConst,
+			Severity: diag.Error,
+			Message: fmt.Sprintf("`%s` is already a const in this scope",name.Value),
+			Span: diag.Span{Start: name.Pos(),End: name.End()},
+			Notes: []string{fmt.Sprintf("`%s` is declared at %s, a function body can declare its own `%s`",name.Value,scope.declaredAt[name.Value],name.Value)},
+		})
+	}
+}
+
+func (p *Parser) constInLoop(name *ast.Identifier) {
+	p.diagnostics = append(p.diagnostics, diag.Diagnostic{
+		Code: ErrConstInLoop,
+		Severity: diag.Error,
+		Message: fmt.Sprintf("`%s` cannot be a const in a loop body, every iteration would bind it again",name.Value),
+		Span: diag.Span{Start: name.Pos(),End: name.End()},
+		Notes: []string{fmt.Sprintf("declare `%s` with let, or as a const before the loop",name.Value)},
+	})
+}
+
+// an assignment changes the binding the evaluator finds at that point: one made
+// earlier in the same scope, or else one in an enclosing scope
+func (p *Parser) checkAssign(scope *constScope, name *ast.Identifier) {
+	var pos token.Position
+	found:=false
+	if isConst,ok:=scope.declared[name.Value];ok {
+		if !isConst {
+			return
+		}
+		pos,found=scope.declaredAt[name.Value],true
+	}
+	for s:=scope.outer;s!=nil && !found;s=s.outer {
+		if pos,found=s.consts[name.Value];!found && s.bound[name.Value] {
+			return
+		}
+	}
+	if !found {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, diag.Diagnostic{
+		Code: ErrAssignConst,
+		Severity: diag.Error,
+		Message: fmt.Sprintf("cannot assign to `%s`, it is a const",name.Value),
+		Span: diag.Span{Start: name.Pos(),End: name.End()},
+		Notes: []string{fmt.Sprintf("`%s` is declared at %s, use let for a variable that changes",name.Value,pos)},
+	})
+}
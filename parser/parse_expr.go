@@ -2,23 +2,33 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/diag"
 	"github.com/Sumz-K/Go-Interpreter/token"
 
 )
 
-// for operator precedence ig
+// for operator precedence ig. The binary operators between SUM and PRODUCT are
+// grouped like Go's, so a & b == c is (a & b) == c. ** binds tighter than a
+// prefix operator, -2 ** 2 is -(2 ** 2). It and assignment are right associative
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN // = += -= *= /=
+	LOGICAL_OR // ||
+	LOGICAL_AND // &&
 	EQUALS // ==
-	LESSGREATER // > or <
-	SUM //+
-	PRODUCT //*
-	PREFIX //-Xor!X
+	LESSGREATER // > or < or <= or >=
+	SUM //+ - | ^
+	PRODUCT //* / % << >> &
+	PREFIX //-Xor!Xor~X
+	POWER // X ** Y
 	CALL // myFunction(X)
+	INDEX // array[index]
 	)
 	
 
@@ -31,15 +41,32 @@ type (
 	infixParseFn func(ast.Expression) ast.Expression  // in infix cases the tokens to the left of the operator need to be passed in as a parameter
 )
 var precedences = map[token.TokenType]int {
+	token.ASSIGN: ASSIGN,
+	token.PLUS_ASSIGN: ASSIGN,
+	token.MINUS_ASSIGN: ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN: ASSIGN,
+	token.OR: LOGICAL_OR,
+	token.AND: LOGICAL_AND,
 	token.EQ: EQUALS,
 	token.NOTEQ:EQUALS,
 	token.LT:LESSGREATER,
 	token.GT:LESSGREATER,
+	token.LTE:LESSGREATER,
+	token.GTE:LESSGREATER,
 	token.PLUS:SUM,
 	token.MINUS:SUM,
+	token.PIPE:SUM,
+	token.CARET:SUM,
 	token.ASTERISK:PRODUCT,
 	token.SLASH:PRODUCT,
+	token.PERCENT:PRODUCT,
+	token.SHL:PRODUCT,
+	token.SHR:PRODUCT,
+	token.AMPERSAND:PRODUCT,
+	token.POWER:POWER,
 	token.LPAREN:CALL,
+	token.LBRACKET:INDEX,
 
 }
 
@@ -72,9 +99,14 @@ func (p* Parser) parseExpressionStmt() *ast.ExpressionStmt {
 	stmt:=&ast.ExpressionStmt{}
 	stmt.Token=p.currToken
 
+	// an if starting the statement keeps break and continue working in its blocks
+	branchOK:=p.branchOK
+	p.ifBranchOK=branchOK && p.isCurr(token.IF)
+	p.branchOK=false
 	stmt.Expression=p.parseExpression(LOWEST)
+	p.branchOK=branchOK
 
-	if p.isNext(token.SEMICOLON) { // the semicolon is optional in the langauge 
+	if !p.panicking && p.isNext(token.SEMICOLON) { // the semicolon is optional in the langauge 
 		p.next()
 	}
 	return stmt 
@@ -85,10 +117,13 @@ func (p* Parser) parseExpression(precedence int) ast.Expression {
 	// 5*5
 	if prefix==nil {
 		p.noPrefixFuncErr(p.currToken.Type)
-		return nil 
+		return p.badExpr(p.currToken,nil)
 	}
 
 	leftExpr:=prefix() // if the function is present call the function and obtain the expression
+	if p.panicking { // no point looking for operators after a broken operand
+		return leftExpr
+	}
 
 	for p.peekToken.Type!=token.SEMICOLON && precedence<p.peekPrecedence(){
 		infix:=p.infixFunc[p.peekToken.Type]
@@ -97,6 +132,9 @@ func (p* Parser) parseExpression(precedence int) ast.Expression {
 		}
 		p.next()
 		leftExpr=infix(leftExpr)
+		if p.panicking {
+			return leftExpr
+		}
 	}
 	return  leftExpr
 
@@ -108,8 +146,12 @@ func (p* Parser) isNext(tok token.TokenType) bool {
 }
 
 func (p* Parser) noPrefixFuncErr(tok token.TokenType) {
-	msg:=fmt.Sprintf("There exists no prefix parse function for token %s",tok)
-	p.errors = append(p.errors, msg)
+	p.report(diag.Diagnostic{
+		Code: ErrNoPrefixFunc,
+		Severity: diag.Error,
+		Message: fmt.Sprintf("unexpected %s, there exists no prefix parse function for token %s",describe(p.currToken),tok),
+		Span: diag.TokenSpan(p.currToken),
+	})
 }
 
 
@@ -123,11 +165,19 @@ func (p* Parser) parseIntLiteral() ast.Expression {
 	il:=&ast.IntegerLiteral{}
 	il.Token=p.currToken
 
-	intVal,err:=strconv.Atoi(p.currToken.Value)
-	if err!=nil {
-		fmt.Printf("Error converting %q string to integer",p.currToken.Value)
-		p.addError(token.INTEGER)
-		return nil 
+	intVal,err:=parseInteger(p.currToken.Value)
+	if err!=nil || intVal>math.MaxInt64 {
+		d:=diag.Diagnostic{
+			Code: ErrBadInteger,
+			Severity: diag.Error,
+			Message: fmt.Sprintf("%s does not fit in a 64 bit integer, the largest is %d",describe(p.currToken),math.MaxInt64),
+			Span: diag.TokenSpan(p.currToken),
+		}
+		if err==nil && intVal==math.MaxInt64+1 { // -9223372036854775808 negates a literal that does not fit
+			d.Notes=append(d.Notes,"the smallest integer has to be written as -9223372036854775807 - 1")
+		}
+		p.report(d)
+		return p.badExpr(il.Token,nil)
 	}
 	il.Value=int64(intVal)
 
@@ -135,6 +185,51 @@ func (p* Parser) parseIntLiteral() ast.Expression {
 
 }
 
+// the value of an integer literal the lexer accepted, a 0x 0o or 0b prefix picks
+// the base and _ only separates digits
+func parseInteger(lit string) (uint64,error) {
+	base:=10
+	if len(lit)>=2 && lit[0]=='0' {
+		switch lit[1] {
+		case 'x','X':
+			base=16
+		case 'o','O':
+			base=8
+		case 'b','B':
+			base=2
+		}
+		if base!=10 {
+			lit=lit[2:]
+		}
+	}
+	return strconv.ParseUint(strings.ReplaceAll(lit,"_",""),base,64)
+}
+
+
+func (p* Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken,Value: p.currToken.Value}
+}
+
+// the lexer already found what is wrong with an ILLEGAL token, report its error
+func (p* Parser) parseIllegal() ast.Expression {
+	tok:=p.currToken
+	d:=diag.Diagnostic{
+		Code: ErrNoPrefixFunc,
+		Severity: diag.Error,
+		Message: fmt.Sprintf("illegal token %s",describe(tok)),
+		Span: diag.TokenSpan(tok),
+	}
+	for _,err:=range p.l.Errors() {
+		if err.Pos.Offset>=tok.Pos.Offset && err.Pos.Offset<tok.End.Offset {
+			d.Code=err.Code
+			d.Message=err.Msg
+			d.Span=diag.Span{Start: err.Pos,End: err.End}
+			break
+		}
+	}
+	p.report(d)
+	return p.badExpr(tok,nil)
+}
 
 // actually parses exprs of type -5 and !5 etc
 func (p* Parser) parsePrefixExpression() ast.Expression{
@@ -150,6 +245,11 @@ func (p* Parser) parsePrefixExpression() ast.Expression{
 
 
 
+// operators that group to the right, a ** b ** c is a ** (b ** c)
+var rightAssociative = map[token.TokenType]bool {
+	token.POWER: true,
+}
+
 func (p* Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	ie:=&ast.InfixExpression{
 		Token: p.currToken,
@@ -157,11 +257,53 @@ func (p* Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		LeftExpr: left,
 	}
 	prec:=p.currPrecedence()
+	if rightAssociative[p.currToken.Type] {
+		prec-- // so the right operand takes in the next operator of the same precedence
+	}
 	p.next()
 	ie.RightExpr=p.parseExpression(prec)
 	return ie
 }
 
+// the target is parsed before the = is seen, as an ordinary expression. Only
+// a name or an index expression can be assigned to, the value takes in any
+// further assignment so a = b = 1 sets both
+func (p* Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	ae:=&ast.AssignExpression{
+		Token: p.currToken,
+		Target: target,
+		Operator: p.currToken.Value,
+	}
+	switch target.(type) {
+	case *ast.Identifier,*ast.IndexExpression:
+	default:
+		p.report(diag.Diagnostic{
+			Code: ErrBadAssignTarget,
+			Severity: diag.Error,
+			Message: fmt.Sprintf("cannot assign to %s",target.String()),
+			Span: diag.Span{Start: target.Pos(),End: target.End()},
+			Notes: []string{"only a name or an element like a[i] or h[\"k\"] can be assigned to"},
+		})
+		return p.badExpr(ae.Token,ae)
+	}
+	p.next()
+	ae.Value=p.parseExpression(ASSIGN-1)
+	return ae
+}
+
+// like an infix expression, both operators are left associative
+func (p* Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	le:=&ast.LogicalExpression{
+		Token: p.currToken,
+		Operator: p.currToken.Value,
+		Left: left,
+	}
+	prec:=p.currPrecedence()
+	p.next()
+	le.Right=p.parseExpression(prec)
+	return le
+}
+
 func (p* Parser) parseBoolean() ast.Expression{
 	expr:=&ast.Boolean{}
 	expr.Token=p.currToken
@@ -176,11 +318,12 @@ func (p* Parser) parseBoolean() ast.Expression{
 
 // (1+2)*3
 func (p* Parser) parseGrouped() ast.Expression {
+	lparen:=p.currToken
 	p.next()
 	expr:=p.parseExpression(LOWEST)
 
-	if !p.expected(token.RPAREN) {
-		return nil 
+	if !p.expected(token.RPAREN,fmt.Sprintf("the `(` at %s is never closed",lparen.Pos)) {
+		return p.badExpr(lparen,expr)
 	}
 	return expr 
 }
@@ -189,37 +332,50 @@ func (p* Parser) parseGrouped() ast.Expression {
 func(p *Parser) parseIfExpression() ast.Expression {
 	expr:=&ast.IfExpression{}
 	expr.Token=p.currToken
-	if !p.expected(token.LPAREN) {
-		return nil 
+	branchOK:=p.ifBranchOK
+	p.ifBranchOK=false
+	if !p.expected(token.LPAREN,"the condition of an if must be in parentheses, like `if (x) { ... }`") {
+		return p.badExpr(expr.Token,expr)
 	}
+	lparen:=p.currToken
 	p.next()
 	expr.Condition=p.parseExpression(LOWEST)
-	if !p.expected(token.RPAREN) {
-		return nil 
+	if !p.expected(token.RPAREN,fmt.Sprintf("the `(` at %s is never closed",lparen.Pos)) {
+		return p.badExpr(expr.Token,expr)
 	}
 
-	if !p.expected(token.LBRACE) {
-		return nil 
+	if !p.expected(token.LBRACE,"the body of an if must be a block, like `if (x) { ... }`") {
+		return p.badExpr(expr.Token,expr)
 	}
 
-	expr.Consequence=p.parseBlock()
+	expr.Consequence=p.parseBlockWith(branchOK)
 
 	if p.isNext(token.ELSE) {
 		p.next()
-		if !p.expected(token.LBRACE) {
-			return nil 
+		if !p.expected(token.LBRACE,"the body of an else must be a block, like `else { ... }`") {
+			return p.badExpr(expr.Token,expr)
 		}
-		expr.Alternative=p.parseBlock()
+		expr.Alternative=p.parseBlockWith(branchOK)
 	}
 
 	return expr
 }
 
+// parseBlock with break and continue allowed as its statements or not
+func (p *Parser) parseBlockWith(branchOK bool) *ast.BlockStmt {
+	outer:=p.branchOK
+	p.branchOK=branchOK
+	block:=p.parseBlock()
+	p.branchOK=outer
+	return block
+}
+
 func(p *Parser) parseBlock() *ast.BlockStmt {
 	block:=&ast.BlockStmt{}
 	block.Token=p.currToken
 	block.Statements=[]ast.Statement{}
 
+	level:=p.depth
 	p.next()
 
 	for !p.isCurr(token.RBRACE) && !p.isCurr(token.EOF) {
@@ -227,8 +383,29 @@ func(p *Parser) parseBlock() *ast.BlockStmt {
 		if stmt!=nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.panicking {
+			p.synchronize(level)
+			if p.depth<level { // the broken statement ran into the end of the block
+				break
+			}
+		}
 		p.next()
 	}
+	block.Rbrace=p.currToken
+	if p.isCurr(token.EOF) {
+		p.report(diag.Diagnostic{
+			Code: ErrExpectedToken,
+			Severity: diag.Error,
+			Message: "expected `}`, got end of input instead",
+			Span: diag.TokenSpan(p.currToken),
+			Notes: []string{fmt.Sprintf("the `{` at %s is never closed",block.Token.Pos)},
+			Fix: &diag.Fix{
+				Message: "did you mean to close the block with `}`?",
+				Span: diag.Span{Start: p.currToken.Pos,End: p.currToken.Pos},
+				Replacement: "}",
+			},
+		})
+	}
 	return block 
 }
 
@@ -237,21 +414,25 @@ func (p* Parser) parseFunction() ast.Expression {
 	expr:=&ast.Function{}
 	expr.Token=p.currToken
 
-	if !p.expected(token.LPAREN) {
-		return nil 
+	if !p.expected(token.LPAREN,"a function literal starts with its parameter list, like `fn(x, y) { ... }`") {
+		return p.badExpr(expr.Token,expr)
 	}
 
 	expr.Params=p.parseFunctionParams()
 	
 
 	if !p.expected(token.RPAREN) {
-		return nil 
+		return p.badExpr(expr.Token,expr)
 	}
 
-	if !p.expected(token.LBRACE) {
-		return nil 
+	if !p.expected(token.LBRACE,"the body of a function must be a block, like `fn(x) { ... }`") {
+		return p.badExpr(expr.Token,expr)
 	}
-	expr.Body=p.parseBlock()
+	// a loop around the literal is not one its body can break out of
+	loopDepth:=p.loopDepth
+	p.loopDepth=0
+	expr.Body=p.parseBlockWith(false)
+	p.loopDepth=loopDepth
 
 	return expr 
 
@@ -261,12 +442,13 @@ func (p* Parser) parseFunction() ast.Expression {
 func (p* Parser) parseFunctionParams() []*ast.Identifier {
 	ids:=[]*ast.Identifier{}
 
-	if p.isNext(token.RPAREN) {
-		p.next()
+	if p.isNext(token.RPAREN) { // fn() , parseFunction consumes the )
 		return ids 
 	}
 
-	p.next()
+	if !p.expected(token.IDENTIFIER) {
+		return ids
+	}
 	id1:=&ast.Identifier{
 		Token: p.currToken,
 		Value: p.currToken.Value,
@@ -274,9 +456,11 @@ func (p* Parser) parseFunctionParams() []*ast.Identifier {
 
 	ids = append(ids, id1)
 
-	for !p.isNext(token.RPAREN) {
-		p.next()
+	for p.isNext(token.COMMA) {
 		p.next() //to skip comma 
+		if !p.expected(token.IDENTIFIER) {
+			return ids
+		}
 
 		ident:=&ast.Identifier{
 			Token: p.currToken,
@@ -295,30 +479,91 @@ func (p* Parser) parseCallExpression(function ast.Expression) ast.Expression {
 		Token: p.currToken,
 		Function: function,
 	}
-	call.Arguments=p.parseCallArgs()
+	args,ok:=p.parseExpressionList(token.RPAREN)
+	call.Arguments=args
+	if !ok {
+		return p.badExpr(call.Token,call)
+	}
+	call.Rparen=p.currToken
 	return call 
 }
 
-// add(2,3) currToken at (
-func(p* Parser) parseCallArgs() []ast.Expression{
+// comma separated expressions up to end, like the arguments of add(2,3) or the elements of [1,2]
+// currToken is at the opening ( or [, on error the expressions parsed so far are returned along with false
+func(p* Parser) parseExpressionList(end token.TokenType) ([]ast.Expression,bool){
 	var args []ast.Expression
-	if p.isNext(token.RPAREN) {
+	if p.isNext(end) {
 		p.next()
-		return args 
+		return args,true 
 	}
 	p.next()
 	args = append(args, p.parseExpression(LOWEST))
-	for !p.isNext(token.RPAREN) {
+	for p.isNext(token.COMMA) {
 		p.next()
 		p.next()
 		args = append(args, p.parseExpression(LOWEST))
 	}
 
-	if !p.expected(token.RPAREN) {
-		return nil 
+	if !p.expected(end) {
+		return args,false 
 	}
 
-	return args 
+	return args,true 
 	
 
-}
\ No newline at end of file
+}
+
+
+// [1, 2 * 3, fn(x) { x }]
+func (p* Parser) parseArrayLiteral() ast.Expression {
+	array:=&ast.ArrayLiteral{Token: p.currToken}
+
+	elements,ok:=p.parseExpressionList(token.RBRACKET)
+	array.Elements=elements
+	if !ok {
+		return p.badExpr(array.Token,array)
+	}
+	array.Rbracket=p.currToken
+	return array
+}
+
+// arr[1], currToken at [
+func (p* Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expr:=&ast.IndexExpression{Token: p.currToken,Left: left}
+
+	p.next()
+	expr.Index=p.parseExpression(LOWEST)
+
+	if !p.expected(token.RBRACKET) {
+		return p.badExpr(expr.Token,expr)
+	}
+	expr.Rbracket=p.currToken
+	return expr
+}
+
+// {"name": "monkey", 1: true}, currToken at {
+func (p* Parser) parseHashLiteral() ast.Expression {
+	hash:=&ast.HashLiteral{Token: p.currToken}
+
+	for !p.isNext(token.RBRACE) {
+		p.next()
+		pair:=&ast.HashPair{Key: p.parseExpression(LOWEST)}
+		hash.Pairs = append(hash.Pairs, pair)
+
+		if !p.expected(token.COLON,"the entries of a hash literal are written key: value") {
+			return p.badExpr(hash.Token,hash)
+		}
+		p.next()
+		pair.Value=p.parseExpression(LOWEST)
+
+		if !p.isNext(token.RBRACE) && !p.expected(token.COMMA) {
+			return p.badExpr(hash.Token,hash)
+		}
+	}
+
+	if !p.expected(token.RBRACE) {
+		return p.badExpr(hash.Token,hash)
+	}
+	hash.Rbrace=p.currToken
+	return hash
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/diag"
 	"github.com/Sumz-K/Go-Interpreter/lexer"
 	"github.com/Sumz-K/Go-Interpreter/token"
 )
@@ -13,7 +14,13 @@ type Parser struct {
     l *lexer.Lexer
     currToken token.Token
     peekToken token.Token
-    errors []string
+    diagnostics []diag.Diagnostic
+    panicking bool // set by the first error in a statement, cleared by synchronize
+    depth int // how many { are open up to and including currToken
+    loopDepth int // loops open around currToken in the function being parsed
+    branchOK bool // break and continue are allowed as the statements being parsed
+    ifBranchOK bool // they are allowed in the blocks of the if about to be parsed
+    consts map[string]token.Position // the top level consts of earlier programs, see KeepConsts
 
     prefixFunc map[token.TokenType]prefixParseFn
     infixFunc map[token.TokenType]infixParseFn
@@ -22,20 +29,25 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
     p:=&Parser{
         l:l,
-        errors: []string{},
+        diagnostics: []diag.Diagnostic{},
     }
 
     // initialise the prefix map and register a function to parse ids 
     p.prefixFunc=make(map[token.TokenType]prefixParseFn)
     p.registerPrefixFunc(token.IDENTIFIER,p.parseIdentifier)
     p.registerPrefixFunc(token.INTEGER,p.parseIntLiteral)
+    p.registerPrefixFunc(token.STRING,p.parseStringLiteral)
+    p.registerPrefixFunc(token.ILLEGAL,p.parseIllegal)
     p.registerPrefixFunc(token.MINUS,p.parsePrefixExpression)
     p.registerPrefixFunc(token.BANG,p.parsePrefixExpression)
+    p.registerPrefixFunc(token.TILDE,p.parsePrefixExpression)
     p.registerPrefixFunc(token.TRUE,p.parseBoolean)
     p.registerPrefixFunc(token.FALSE,p.parseBoolean)
     p.registerPrefixFunc(token.LPAREN,p.parseGrouped)
     p.registerPrefixFunc(token.IF,p.parseIfExpression)
     p.registerPrefixFunc(token.FUNC,p.parseFunction)
+    p.registerPrefixFunc(token.LBRACKET,p.parseArrayLiteral)
+    p.registerPrefixFunc(token.LBRACE,p.parseHashLiteral) // only reached in expression position, blocks are parsed by parseBlock
 
     p.infixFunc=make(map[token.TokenType]infixParseFn)
     p.registerInfixFunc(token.PLUS,p.parseInfixExpression)
@@ -46,7 +58,18 @@ func New(l *lexer.Lexer) *Parser {
     p.registerInfixFunc(token.LT,p.parseInfixExpression)
     p.registerInfixFunc(token.EQ,p.parseInfixExpression)
     p.registerInfixFunc(token.NOTEQ,p.parseInfixExpression)
+    for _,op:=range []token.TokenType{token.LTE,token.GTE,token.PERCENT,token.POWER,
+        token.AMPERSAND,token.PIPE,token.CARET,token.SHL,token.SHR} {
+        p.registerInfixFunc(op,p.parseInfixExpression)
+    }
+    p.registerInfixFunc(token.AND,p.parseLogicalExpression)
+    p.registerInfixFunc(token.OR,p.parseLogicalExpression)
+    for _,op:=range []token.TokenType{token.ASSIGN,token.PLUS_ASSIGN,token.MINUS_ASSIGN,
+        token.ASTERISK_ASSIGN,token.SLASH_ASSIGN} {
+        p.registerInfixFunc(op,p.parseAssignExpression)
+    }
     p.registerInfixFunc(token.LPAREN,p.parseCallExpression)
+    p.registerInfixFunc(token.LBRACKET,p.parseIndexExpression)
     //Read two tokens to set the current and peek tokens
     p.next()
     p.next()
@@ -57,16 +80,143 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) next() {
     p.currToken=p.peekToken
     p.peekToken=p.l.NextToken()
+    for p.peekToken.Type==token.COMMENT { // only there when the lexer was asked to keep them
+        p.peekToken=p.l.NextToken()
+    }
+
+    switch p.currToken.Type {
+    case token.LBRACE:
+        p.depth++
+    case token.RBRACE:
+        if p.depth>0 { // a stray } at the top level closes nothing
+            p.depth--
+        }
+    }
 }
 
+// error codes of the diagnostics the parser reports
+const (
+    ErrExpectedToken = "E0001" // the next token is not the one the grammar requires
+    ErrNoPrefixFunc = "E0002" // a token that cannot start an expression
+    ErrBadInteger = "E0003" // an integer literal that does not fit
+    ErrMisplacedBranch = "E0004" // a break or continue that is not a statement of a loop body
+    ErrBadAssignTarget = "E0005" // the left side of an assignment is not a name or an index expression
+    ErrAssignConst = "E0006" // an assignment to a const
+    ErrRedeclareConst = "E0007" // a const bound again in its scope
+    ErrConstInLoop = "E0008" // a const in a loop body, which would bind it again every iteration
+)
+
+// one line per error, see Diagnostics for the structured form
 func (p* Parser) ShowErrors() []string {
-    return p.errors
+    msgs:=make([]string,0,len(p.diagnostics))
+    for _,d:=range p.diagnostics {
+        msgs = append(msgs, d.Error())
+    }
+    return msgs
+}
+
+func (p* Parser) Diagnostics() []diag.Diagnostic {
+    return p.diagnostics
+}
+
+// records d unless we are already recovering from an error in this statement,
+// whatever goes wrong after the first error is almost always a consequence of it
+func (p *Parser) report(d diag.Diagnostic) {
+    if p.panicking {
+        return
+    }
+    p.diagnostics = append(p.diagnostics, d)
+    p.panicking=true
+}
+
+// panic mode recovery, skips ahead to the end of the broken statement: onto its ;
+// or up to a statement keyword or the } closing the enclosing block. level is the
+// brace depth the statement started at, so braces the statement opened (whether
+// before or after the error) are skipped as a whole
+func (p *Parser) synchronize(level int) {
+    for !p.isCurr(token.EOF) && p.depth>=level { // below level the } of the enclosing block was swallowed
+        if p.depth==level {
+            if p.isCurr(token.SEMICOLON) {
+                break
+            }
+            if p.isNext(token.LET) || p.isNext(token.CONST) || p.isNext(token.RETURN) || p.isNext(token.WHILE) || p.isNext(token.FOR) ||
+                p.isNext(token.BREAK) || p.isNext(token.CONTINUE) || p.isNext(token.RBRACE) || p.isNext(token.EOF) {
+                break
+            }
+        }
+        p.next()
+    }
+    p.panicking=false
+}
+
+// placeholder for an expression that failed to parse, starting at start
+func (p *Parser) badExpr(start token.Token, partial ast.Expression) *ast.BadExpr {
+    return &ast.BadExpr{Token: start,Partial: partial,To: p.currToken.End}
 }
 
-func (p *Parser) addError(t token.TokenType) {
-    msg:=fmt.Sprintf("expected next token to be %s, got %s instead",t, p.peekToken.Type)
+func (p *Parser) badStmt(start token.Token, partial ast.Statement) *ast.BadStmt {
+    return &ast.BadStmt{Token: start,Partial: partial,To: p.currToken.End}
+}
+
+// reports that the peek token is not t, notes explain the context to the user
+func (p *Parser) addError(t token.TokenType, notes ...string) {
+    d:=diag.Diagnostic{
+        Code: ErrExpectedToken,
+        Severity: diag.Error,
+        Message: fmt.Sprintf("expected next token to be %s, got %s instead",describeType(t),describe(p.peekToken)),
+        Span: diag.TokenSpan(p.peekToken),
+        Notes: notes,
+    }
+
+    // punctuation has exactly one spelling, so we can offer to insert it
+    if isPunctuation(t) {
+        d.Fix=&diag.Fix{
+            Message: fmt.Sprintf("did you mean to insert `%s` after %s?",t,describe(p.currToken)),
+            Span: diag.Span{Start: p.currToken.End,End: p.currToken.End},
+            Replacement: string(t),
+        }
+    }
+    p.report(d)
+}
+
+// how a token is named in error messages
+func describe(tok token.Token) string {
+    switch tok.Type {
+    case token.EOF:
+        return "end of input"
+    case token.IDENTIFIER:
+        return fmt.Sprintf("identifier `%s`",tok.Value)
+    case token.INTEGER:
+        return fmt.Sprintf("integer `%s`",tok.Value)
+    case token.STRING:
+        return fmt.Sprintf("string %q",tok.Value)
+    }
+    return fmt.Sprintf("`%s`",tok.Value)
+}
+
+func describeType(t token.TokenType) string {
+    switch t {
+    case token.EOF:
+        return "end of input"
+    case token.IDENTIFIER:
+        return "an identifier"
+    case token.INTEGER:
+        return "an integer"
+    case token.STRING:
+        return "a string"
+    }
+    if isPunctuation(t) {
+        return fmt.Sprintf("`%s`",t)
+    }
+    return string(t)
+}
 
-    p.errors = append(p.errors,msg)
+func isPunctuation(t token.TokenType) bool {
+    switch t {
+    case token.ASSIGN,token.COMMA,token.SEMICOLON,token.COLON,token.LPAREN,token.RPAREN,token.LBRACE,token.RBRACE,token.LBRACKET,token.RBRACKET:
+        return true
+    }
+    return false
 }
 
 
@@ -79,8 +229,15 @@ func (p *Parser) ParseProgram() *ast.Program {
         if statement!=nil {
             program.Statements = append(program.Statements, statement)
         }
+        if p.panicking {
+            p.synchronize(0)
+        }
         p.next()
     }
+    // the checks need the whole tree, a broken one would only give more errors
+    if len(p.diagnostics)==0 {
+        p.checkConsts(program)
+    }
     return program
 }
 
@@ -89,10 +246,16 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p* Parser) parseStmt() ast.Statement {
     switch p.currToken.Type {
-        case token.LET:
+        case token.LET,token.CONST:
             return p.parseLetStmt()
         case token.RETURN:
             return p.parseReturnStmt()
+        case token.WHILE:
+            return p.parseWhileStmt()
+        case token.FOR:
+            return p.parseForStmt()
+        case token.BREAK,token.CONTINUE:
+            return p.parseBranchStmt()
         default:
             return p.parseExpressionStmt()
     }
@@ -107,7 +270,7 @@ func (p* Parser) parseReturnStmt() ast.Statement {
 
     stmt.ReturnValue=p.parseExpression(LOWEST)
 
-    if p.isNext(token.SEMICOLON) {
+    if !p.panicking && p.isNext(token.SEMICOLON) {
         p.next()
     }
 
@@ -115,12 +278,21 @@ func (p* Parser) parseReturnStmt() ast.Statement {
 }
 
 func (p* Parser) parseLetStmt() ast.Statement {
+    stmt:=p.parseLet()
+    if !p.panicking && p.isNext(token.SEMICOLON) {
+        p.next()
+    }
+    return stmt
+}
+
+// a let without the ; after it, which a for clause must leave alone
+func (p* Parser) parseLet() ast.Statement {
     stmt:=&ast.LetStmt{}
 
-    stmt.Token=p.currToken //token.LET
+    stmt.Token=p.currToken //token.LET or token.CONST
 
     if !p.expected(token.IDENTIFIER) {
-        return nil //nect token has to be an ID``
+        return p.badStmt(stmt.Token,stmt) //nect token has to be an ID``
     }
     stmt.Name=&ast.Identifier{
         Token: p.currToken, //IDENTIFIER token
@@ -128,20 +300,132 @@ func (p* Parser) parseLetStmt() ast.Statement {
     }
 
     if !p.expected(token.ASSIGN) { //check if next token is "="
-        return nil
+        return p.badStmt(stmt.Token,stmt)
     }
 
     p.next()
 
     stmt.Value=p.parseExpression(LOWEST)
-    if p.isNext(token.SEMICOLON) {
-        p.next()
+    return stmt
+}
+
+// while (cond) { ... }
+func (p* Parser) parseWhileStmt() ast.Statement {
+    stmt:=&ast.WhileStmt{Token: p.currToken}
+    if !p.expected(token.LPAREN,"the condition of a while must be in parentheses, like `while (x) { ... }`") {
+        return p.badStmt(stmt.Token,stmt)
     }
+    lparen:=p.currToken
+    p.next()
+    stmt.Condition=p.parseExpression(LOWEST)
+    if p.panicking || !p.expected(token.RPAREN,fmt.Sprintf("the `(` at %s is never closed",lparen.Pos)) {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    if !p.expected(token.LBRACE,"the body of a while must be a block, like `while (x) { ... }`") {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    stmt.Body=p.parseLoopBody()
+    return stmt
+}
 
+// for (init; cond; post) { ... } or for (x in xs) { ... }
+func (p* Parser) parseForStmt() ast.Statement {
+    stmt:=&ast.ForStmt{Token: p.currToken}
+    if !p.expected(token.LPAREN,"the clauses of a for must be in parentheses, like `for (x in xs) { ... }`") {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    lparen:=p.currToken
+    p.next()
+    if p.isCurr(token.IDENTIFIER) && p.isNext(token.IN) {
+        return p.parseForInStmt(stmt.Token,lparen)
+    }
 
+    clauses:="a for loop has three clauses separated by `;`, like `for (let i = 0; i < n; i += 1) { ... }`"
+    if !p.isCurr(token.SEMICOLON) {
+        stmt.Init=p.parseForClause()
+        if p.panicking || !p.expected(token.SEMICOLON,clauses) {
+            return p.badStmt(stmt.Token,stmt)
+        }
+    }
+    p.next()
+    if !p.isCurr(token.SEMICOLON) {
+        stmt.Condition=p.parseExpression(LOWEST)
+        if p.panicking || !p.expected(token.SEMICOLON,clauses) {
+            return p.badStmt(stmt.Token,stmt)
+        }
+    }
+    p.next()
+    if !p.isCurr(token.RPAREN) {
+        stmt.Post=p.parseForClause()
+        if p.panicking || !p.expected(token.RPAREN,fmt.Sprintf("the `(` at %s is never closed",lparen.Pos)) {
+            return p.badStmt(stmt.Token,stmt)
+        }
+    }
+
+    if !p.expected(token.LBRACE,"the body of a for must be a block, like `for (x in xs) { ... }`") {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    stmt.Body=p.parseLoopBody()
     return stmt
+}
+
+// the init or post clause of a for, a let or an expression
+func (p* Parser) parseForClause() ast.Statement {
+    if p.isCurr(token.LET) {
+        return p.parseLet()
+    }
+    return &ast.ExpressionStmt{Token: p.currToken,Expression: p.parseExpression(LOWEST)}
+}
 
+// the rest of for (x in xs) { ... }, currToken is the x
+func (p* Parser) parseForInStmt(tok,lparen token.Token) ast.Statement {
+    stmt:=&ast.ForInStmt{Token: tok}
+    stmt.Variable=&ast.Identifier{Token: p.currToken,Value: p.currToken.Value}
+    p.next() // onto the in
+    p.next()
+    stmt.Iterable=p.parseExpression(LOWEST)
+    if p.panicking || !p.expected(token.RPAREN,fmt.Sprintf("the `(` at %s is never closed",lparen.Pos)) {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    if !p.expected(token.LBRACE,"the body of a for must be a block, like `for (x in xs) { ... }`") {
+        return p.badStmt(stmt.Token,stmt)
+    }
+    stmt.Body=p.parseLoopBody()
+    return stmt
+}
 
+func (p* Parser) parseLoopBody() *ast.BlockStmt {
+    p.loopDepth++
+    body:=p.parseBlockWith(true)
+    p.loopDepth--
+    if !p.panicking && p.isNext(token.SEMICOLON) {
+        p.next()
+    }
+    return body
+}
+
+// break and continue have to be statements of a loop body, or of the blocks of an
+// if statement in one. Anywhere inside an expression, the vm would jump out while
+// the operands evaluated so far are still on its stack
+func (p* Parser) parseBranchStmt() ast.Statement {
+    stmt:=&ast.BranchStmt{Token: p.currToken}
+    if !p.branchOK {
+        msg:=fmt.Sprintf("`%s` outside of a loop",stmt.Token.Value)
+        if p.loopDepth>0 {
+            msg=fmt.Sprintf("`%s` can only be a statement of a loop body or of an if statement in it",stmt.Token.Value)
+        }
+        p.report(diag.Diagnostic{
+            Code: ErrMisplacedBranch,
+            Severity: diag.Error,
+            Message: msg,
+            Span: diag.TokenSpan(stmt.Token),
+        })
+        return p.badStmt(stmt.Token,stmt)
+    }
+    if p.isNext(token.SEMICOLON) {
+        p.next()
+    }
+    return stmt
 }
 
 func (p *Parser) isCurr(tok token.TokenType) bool {
@@ -150,11 +434,12 @@ func (p *Parser) isCurr(tok token.TokenType) bool {
 
 
 
-func (p *Parser) expected(tok token.TokenType) bool {
+// advances if the next token is tok, otherwise reports an error carrying the notes
+func (p *Parser) expected(tok token.TokenType, notes ...string) bool {
     if p.peekToken.Type==tok {
         p.next()
         return true 
     }
-    p.addError(tok)
+    p.addError(tok,notes...)
     return false 
 }
@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Sumz-K/Go-Interpreter/ast"
 	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -196,6 +198,70 @@ func TestIntLiteral(t *testing.T) {
 
 }
 
+func TestIntLiteralBases(t *testing.T) {
+    tests:=[]struct{
+        input string
+        expected int64
+    }{
+        {"0xFF",255},
+        {"0Xff",255},
+        {"0o755",493},
+        {"0b1010",10},
+        {"1_000_000",1000000},
+        {"0x_dead_BEEF",0xdeadbeef},
+        {"010",10},
+        {"9223372036854775807",9223372036854775807},
+        {"0x7fff_ffff_ffff_ffff",9223372036854775807},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+
+        intLit,ok:=program.Statements[0].(*ast.ExpressionStmt).Expression.(*ast.IntegerLiteral)
+        if !ok {
+            t.Fatalf("%q: expected an integer literal got %T",tt.input,program.Statements[0])
+        }
+        if intLit.Value!=tt.expected {
+            t.Errorf("%q: expected %d got %d",tt.input,tt.expected,intLit.Value)
+        }
+        if intLit.String()!=tt.input {
+            t.Errorf("Expected the literal to print as written, %q got %q",tt.input,intLit.String())
+        }
+    }
+}
+
+func TestIntLiteralOverflow(t *testing.T) {
+    tests:=[]struct{
+        input string
+        start string
+        note bool
+    }{
+        {"let x = 9223372036854775808;","1:9",true},
+        {"let x = -0x8000_0000_0000_0000;","1:10",true},
+        {"let x = 99999999999999999999999;","1:9",false},
+        {"let x = 0b1"+strings.Repeat("0",64)+";","1:9",false},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        p.ParseProgram()
+
+        diags:=p.Diagnostics()
+        if len(diags)!=1 {
+            t.Fatalf("%q: expected 1 diagnostic got %v",tt.input,p.ShowErrors())
+        }
+        d:=diags[0]
+        if d.Code!=ErrBadInteger || d.Span.Start.String()!=tt.start {
+            t.Errorf("%q: expected %s at %s got %s",tt.input,ErrBadInteger,tt.start,d.Error())
+        }
+        if (len(d.Notes)>0)!=tt.note {
+            t.Errorf("%q: expected a note %t got %v",tt.input,tt.note,d.Notes)
+        }
+    }
+}
+
 func TestPrefixParse(t *testing.T) {
     tests:=[]struct{
         input string 
@@ -516,3 +582,611 @@ func TestCallExpr(t *testing.T) {
     }
 
 }
+
+func TestFunctionNoParams(t *testing.T) {
+    input:=`fn() { 5 }`
+    l:=lexer.New(input)
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    stmt,ok:=program.Statements[0].(*ast.ExpressionStmt)
+    if !ok {
+        t.Fatalf("Expected an expression statement got %T",program.Statements[0])
+    }
+
+    fn,ok:=stmt.Expression.(*ast.Function)
+    if !ok {
+        t.Fatalf("Expected a function got %T",stmt.Expression)
+    }
+
+    if len(fn.Params)!=0 {
+        t.Errorf("Expected no parameters got %d",len(fn.Params))
+    }
+
+    if len(fn.Body.Statements)!=1 {
+        t.Errorf("Expected one stmt in function body got %d",len(fn.Body.Statements))
+    }
+}
+
+func TestNodeSpans(t *testing.T) {
+    input:="let add = fn(x, y) {\n  x + y;\n};\nadd(1, 2)"
+    l:=lexer.New(input)
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    if len(program.Statements)!=2 {
+        t.Fatalf("Expected 2 statements got %d",len(program.Statements))
+    }
+
+    tests:=[]struct{
+        node ast.Node
+        start,end string
+    }{
+        {program,"1:1","4:10"},
+        {program.Statements[0],"1:1","3:2"},
+        {program.Statements[0].(*ast.LetStmt).Value,"1:11","3:2"},
+        {program.Statements[0].(*ast.LetStmt).Value.(*ast.Function).Body.Statements[0],"2:3","2:8"},
+        {program.Statements[1],"4:1","4:10"},
+    }
+
+    for i,tt:=range tests {
+        if tt.node.Pos().String()!=tt.start {
+            t.Errorf("node %d (%s) starts at %s, expected %s",i,tt.node,tt.node.Pos(),tt.start)
+        }
+        if tt.node.End().String()!=tt.end {
+            t.Errorf("node %d (%s) ends at %s, expected %s",i,tt.node,tt.node.End(),tt.end)
+        }
+    }
+}
+
+func TestDiagnostics(t *testing.T) {
+    tests:=[]struct{
+        input string
+        code string
+        start string
+        fix string
+    }{
+        {"let x = (1 + 2;","E0001","1:15",")"},
+        {"if (x) x","E0001","1:8","{"},
+        {"let 5 = x;","E0001","1:5",""},
+        {"let x = );","E0002","1:9",""},
+    }
+
+    for _,tt:=range tests {
+        l:=lexer.New(tt.input)
+        p:=New(l)
+        p.ParseProgram()
+
+        diags:=p.Diagnostics()
+        if len(diags)==0 {
+            t.Errorf("%q: expected a diagnostic got none",tt.input)
+            continue
+        }
+        d:=diags[0]
+        if d.Code!=tt.code {
+            t.Errorf("%q: expected code %s got %s",tt.input,tt.code,d.Code)
+        }
+        if d.Span.Start.String()!=tt.start {
+            t.Errorf("%q: expected diagnostic at %s got %s",tt.input,tt.start,d.Span.Start)
+        }
+        if tt.fix=="" && d.Fix!=nil {
+            t.Errorf("%q: did not expect a fix got %+v",tt.input,d.Fix)
+        }
+        if tt.fix!="" && (d.Fix==nil || d.Fix.Replacement!=tt.fix) {
+            t.Errorf("%q: expected a fix inserting %q got %+v",tt.input,tt.fix,d.Fix)
+        }
+    }
+}
+
+func TestErrorRecovery(t *testing.T) {
+    tests:=[]struct{
+        input string
+        errors int
+        statements []string // String() of each statement parsed
+    }{
+        {"let x 5; let y = 10; let z = y;",1,[]string{"<bad statement>","let y = 10;","let z = y;"}},
+        {"let x = (1 + 2; let y = 3;",1,[]string{"let x = <bad expression>;","let y = 3;"}},
+        {"foo(1 2); bar(3);",1,[]string{"<bad expression>","bar(3, )"}},
+        {"if (x { y } let z = 1;",1,[]string{"<bad expression>","let z = 1;"}},
+        {"let = 1; let y 2; let z = 3;",2,[]string{"<bad statement>","<bad statement>","let z = 3;"}},
+        {"let f = fn(x) { let = 1; x }; f;",1,[]string{"let f = fn(x, ) {{<bad statement>x}};","f"}},
+        {"let f = fn(x) { x + }; f;",1,[]string{"let f = fn(x, ) {{(x + <bad expression>)}};","f"}},
+        {"let f = fn(x) { x",1,[]string{"let f = fn(x, ) {{x}};"}},
+        {"let f = fn(x, 1) { x }; f;",1,[]string{"let f = <bad expression>;","f"}},
+    }
+
+    for _,tt:=range tests {
+        l:=lexer.New(tt.input)
+        p:=New(l)
+        program:=p.ParseProgram()
+
+        if len(p.ShowErrors())!=tt.errors {
+            t.Errorf("%q: expected %d errors got %d: %v",tt.input,tt.errors,len(p.ShowErrors()),p.ShowErrors())
+        }
+
+        if len(program.Statements)!=len(tt.statements) {
+            t.Errorf("%q: expected %d statements got %d: %q",tt.input,len(tt.statements),len(program.Statements),program.String())
+            continue
+        }
+        for i,stmt:=range program.Statements {
+            if stmt.String()!=tt.statements[i] {
+                t.Errorf("%q: statement %d expected %q got %q",tt.input,i,tt.statements[i],stmt.String())
+            }
+        }
+    }
+}
+
+func TestPartialNodes(t *testing.T) {
+    l:=lexer.New("if (x > 1) x")
+    p:=New(l)
+    program:=p.ParseProgram()
+
+    stmt:=program.Statements[0].(*ast.ExpressionStmt)
+    bad,ok:=stmt.Expression.(*ast.BadExpr)
+    if !ok {
+        t.Fatalf("Expected a bad expression got %T",stmt.Expression)
+    }
+    ifexp,ok:=bad.Partial.(*ast.IfExpression)
+    if !ok {
+        t.Fatalf("Expected the partial node to be an if expression got %T",bad.Partial)
+    }
+    if ifexp.Condition.String()!="(x > 1)" {
+        t.Errorf("Expected the condition to survive got %q",ifexp.Condition.String())
+    }
+}
+
+func TestStringLiteral(t *testing.T) {
+    input:=`"hello\tworld";`
+    l:=lexer.New(input)
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    stmt:=program.Statements[0].(*ast.ExpressionStmt)
+    literal,ok:=stmt.Expression.(*ast.StringLiteral)
+    if !ok {
+        t.Fatalf("Expected a string literal got %T",stmt.Expression)
+    }
+    if literal.Value!="hello\tworld" {
+        t.Errorf("Expected value %q got %q","hello\tworld",literal.Value)
+    }
+    if literal.String()!=`"hello\tworld"` {
+        t.Errorf("Expected String() to give back the source form got %s",literal.String())
+    }
+}
+
+func TestLexerErrorsBecomeDiagnostics(t *testing.T) {
+    l:=lexer.New("let s = \"abc\nlet y = 1;")
+    p:=New(l)
+    program:=p.ParseProgram()
+
+    diags:=p.Diagnostics()
+    if len(diags)!=1 {
+        t.Fatalf("Expected 1 diagnostic got %v",p.ShowErrors())
+    }
+    if diags[0].Code!=lexer.ErrUnterminatedString || diags[0].Span.Start.String()!="1:9" {
+        t.Errorf("Unexpected diagnostic %s",diags[0].Error())
+    }
+    if len(program.Statements)!=2 || program.Statements[1].String()!="let y = 1;" {
+        t.Errorf("Expected parsing to recover got %q",program.String())
+    }
+}
+
+func TestComments(t *testing.T) {
+    input:=`// double it
+let double = fn(x) { /* the body */ x * 2 };
+double(/* five */ 5) // ten`
+
+    // the parser skips COMMENT tokens, so keeping them changes nothing
+    for _,l:=range []*lexer.Lexer{lexer.New(input),lexer.New(input,lexer.WithComments())} {
+        p:=New(l)
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+
+        expected:="let double = fn(x, ) {{(x * 2)}};double(5, )"
+        if program.String()!=expected {
+            t.Errorf("Expected %q got %q",expected,program.String())
+        }
+    }
+}
+
+func TestUnterminatedCommentDiagnostic(t *testing.T) {
+    p:=New(lexer.New("let x = 1;\n/* never closed\nlet y = 2;"))
+    p.ParseProgram()
+
+    diags:=p.Diagnostics()
+    if len(diags)!=1 {
+        t.Fatalf("Expected 1 diagnostic got %v",p.ShowErrors())
+    }
+    if diags[0].Code!=lexer.ErrUnterminatedComment || diags[0].Span.Start.String()!="2:1" {
+        t.Errorf("Unexpected diagnostic %s",diags[0].Error())
+    }
+}
+
+func TestArrayLiteral(t *testing.T) {
+    input:="[1, 2 * 2, 3 + 3]"
+    l:=lexer.New(input)
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    stmt:=program.Statements[0].(*ast.ExpressionStmt)
+    array,ok:=stmt.Expression.(*ast.ArrayLiteral)
+    if !ok {
+        t.Fatalf("Expected an array literal got %T",stmt.Expression)
+    }
+    if len(array.Elements)!=3 {
+        t.Fatalf("Expected 3 elements got %d",len(array.Elements))
+    }
+    compareInt(t,array.Elements[0],1)
+    if array.Elements[1].String()!="(2 * 2)" || array.Elements[2].String()!="(3 + 3)" {
+        t.Errorf("Unexpected elements %s",array.String())
+    }
+}
+
+func TestEmptyArrayLiteral(t *testing.T) {
+    l:=lexer.New("[]")
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    array,ok:=program.Statements[0].(*ast.ExpressionStmt).Expression.(*ast.ArrayLiteral)
+    if !ok || len(array.Elements)!=0 {
+        t.Fatalf("Expected an empty array literal got %s",program.String())
+    }
+}
+
+func TestIndexExpression(t *testing.T) {
+    l:=lexer.New("myArray[1 + 1]")
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    index,ok:=program.Statements[0].(*ast.ExpressionStmt).Expression.(*ast.IndexExpression)
+    if !ok {
+        t.Fatalf("Expected an index expression got %T",program.Statements[0].(*ast.ExpressionStmt).Expression)
+    }
+    if !testID(t,index.Left,"myArray") {
+        return
+    }
+    if index.Index.String()!="(1 + 1)" {
+        t.Errorf("Expected index (1 + 1) got %s",index.Index.String())
+    }
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+    tests:=[]struct{
+        input string
+        expected string
+    }{
+        {"-a * b","((-a) * b)"},
+        {"a + b * c","(a + (b * c))"},
+        {"a + b * c + d / e - f","(((a + (b * c)) + (d / e)) - f)"},
+        {"5 > 4 == 3 < 4","((5 > 4) == (3 < 4))"},
+        {"(5 + 5) * 2","((5 + 5) * 2)"},
+        {"a * [1, 2, 3, 4][b * c] * d","((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+        {"add(a * b[2], b[1], 2 * [1, 2][1])","add((a * (b[2])), (b[1]), (2 * ([1, 2][1])), )"},
+        {"[1, 2, fn(x){x}][2](3)","([1, 2, fn(x, ) {{x}}][2])(3, )"},
+        {"a || b && c","(a || (b && c))"},
+        {"a && b || c && d","((a && b) || (c && d))"},
+        {"a && b && c","((a && b) && c)"},
+        {"-2 ** 2","(-(2 ** 2))"},
+        {"2 ** 3 ** 2","(2 ** (3 ** 2))"},
+        {"2 ** -1 * 3","((2 ** (-1)) * 3)"},
+        {"a * b ** c","(a * (b ** c))"},
+        {"a[0] ** f(b)","((a[0]) ** f(b, ))"},
+        {"a % b * c","((a % b) * c)"},
+        {"a + b << c","(a + (b << c))"},
+        {"a | b & c ^ d","((a | (b & c)) ^ d)"},
+        {"a & b == c","((a & b) == c)"},
+        {"~a & b","((~a) & b)"},
+        {"a <= b == b >= c","((a <= b) == (b >= c))"},
+        {"x < 1 || x > 2 == !y","((x < 1) || ((x > 2) == (!y)))"},
+        {"if (a == 1 && b) { c }","if ((a == 1) && b) {c}"},
+    }
+
+    for _,tt:=range tests {
+        l:=lexer.New(tt.input)
+        p:=New(l)
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+
+        if program.String()!=tt.expected {
+            t.Errorf("%q: expected %q got %q",tt.input,tt.expected,program.String())
+        }
+    }
+}
+
+func TestHashLiteral(t *testing.T) {
+    tests:=[]struct{
+        input string
+        expected string
+    }{
+        {`{"one": 1, "two": 2, "three": 3}`,`{"one": 1, "two": 2, "three": 3}`},
+        {`{}`,`{}`},
+        {`{"one": 0 + 1, true: 10 - 8, 3: 15 / 5}`,`{"one": (0 + 1), true: (10 - 8), 3: (15 / 5)}`},
+        {`{"name": "monkey", 1: true, false: 0}["name"]`,`({"name": "monkey", 1: true, false: 0}["name"])`},
+    }
+
+    for _,tt:=range tests {
+        l:=lexer.New(tt.input)
+        p:=New(l)
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+
+        if program.String()!=tt.expected {
+            t.Errorf("%q: expected %q got %q",tt.input,tt.expected,program.String())
+        }
+    }
+
+    l:=lexer.New(`{"a": 1, "b": 2}`)
+    p:=New(l)
+    program:=p.ParseProgram()
+    hash,ok:=program.Statements[0].(*ast.ExpressionStmt).Expression.(*ast.HashLiteral)
+    if !ok {
+        t.Fatalf("Expected a hash literal got %T",program.Statements[0].(*ast.ExpressionStmt).Expression)
+    }
+    if len(hash.Pairs)!=2 {
+        t.Fatalf("Expected 2 pairs got %d",len(hash.Pairs))
+    }
+    compareInt(t,hash.Pairs[1].Value,2)
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+    tests:=[]string{`{"a" 1}`,`{"a": 1 "b": 2}`,`{"a": 1`}
+
+    for _,input:=range tests {
+        l:=lexer.New(input)
+        p:=New(l)
+        p.ParseProgram()
+        if len(p.ShowErrors())!=1 {
+            t.Errorf("%q: expected one error got %v",input,p.ShowErrors())
+        }
+    }
+}
+
+func TestBlocksAreNotHashes(t *testing.T) {
+    l:=lexer.New(`if (x) { {"a": 1} } else { y }`)
+    p:=New(l)
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    ifexp:=program.Statements[0].(*ast.ExpressionStmt).Expression.(*ast.IfExpression)
+    inner:=ifexp.Consequence.Statements[0].(*ast.ExpressionStmt)
+    if _,ok:=inner.Expression.(*ast.HashLiteral);!ok {
+        t.Errorf("Expected a hash literal inside the block got %T",inner.Expression)
+    }
+}
+
+func TestRecoveryAfterStrayBrace(t *testing.T) {
+    l:=lexer.New("} let x 5; let y = 1;")
+    p:=New(l)
+    program:=p.ParseProgram()
+
+    if len(p.ShowErrors())!=2 {
+        t.Errorf("Expected 2 errors got %v",p.ShowErrors())
+    }
+    last:=program.Statements[len(program.Statements)-1]
+    if last.String()!="let y = 1;" {
+        t.Errorf("Expected parsing to recover got %q",program.String())
+    }
+}
+
+func TestLoops(t *testing.T) {
+    tests:=[]struct{
+        input string
+        expected string
+    }{
+        {"while (x < 10) { let x = x + 1; }","while ((x < 10)) {let x = (x + 1);}"},
+        {"for (let i = 0; i < 3; let i = i + 1) { puts(i) }","for (let i = 0; (i < 3); let i = (i + 1)) {puts(i, )}"},
+        {"for (;;) { break; }","for (; ; ) {break;}"},
+        {"for (f(); ; g()) { continue }","for (f(); ; g()) {continue;}"},
+        {"for (x in [1, 2]) { puts(x) }","for (x in [1, 2]) {puts(x, )}"},
+        {"while (true) { if (x) { break } else { continue } }","while (true) {if x {break;} else {continue;}}"},
+        // a loop can be followed by a ;
+        {"while (true) { break }; 1","while (true) {break;}1"},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+        if program.String()!=tt.expected {
+            t.Errorf("%q: expected %q got %q",tt.input,tt.expected,program.String())
+        }
+    }
+}
+
+func TestMisplacedBranch(t *testing.T) {
+    tests:=[]struct{
+        input string
+        start string
+        message string
+    }{
+        {"break;","1:1","`break` outside of a loop"},
+        {"if (true) { continue }","1:13","`continue` outside of a loop"},
+        {"while (true) { let f = fn() { break }; }","1:31","`break` outside of a loop"},
+        {"while (true) { let x = if (true) { break }; }","1:36","`break` can only be a statement"},
+        {"while (true) { 1 + if (true) { continue }; }","1:32","`continue` can only be a statement"},
+        {"while (true) { puts(if (true) { break }) }","1:33","`break` can only be a statement"},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        p.ParseProgram()
+
+        diags:=p.Diagnostics()
+        if len(diags)!=1 {
+            t.Fatalf("%q: expected 1 diagnostic got %v",tt.input,p.ShowErrors())
+        }
+        d:=diags[0]
+        if d.Code!=ErrMisplacedBranch || d.Span.Start.String()!=tt.start || !strings.HasPrefix(d.Message,tt.message) {
+            t.Errorf("%q: expected %s %q at %s got %s",tt.input,ErrMisplacedBranch,tt.message,tt.start,d.Error())
+        }
+    }
+}
+
+func TestLoopSyntaxErrors(t *testing.T) {
+    for _,input:=range []string{"while true { }","while (true) 1","for (let i = 0; i < 3 { }","for (x in xs { }","for x in xs { }"} {
+        p:=New(lexer.New(input))
+        p.ParseProgram()
+        diags:=p.Diagnostics()
+        if len(diags)==0 || diags[0].Code!=ErrExpectedToken {
+            t.Errorf("%q: expected %s got %v",input,ErrExpectedToken,p.ShowErrors())
+        }
+    }
+}
+
+func TestAssignExpressions(t *testing.T) {
+    tests:=[]struct{
+        input string
+        expected string
+    }{
+        {"x = 5;","(x = 5)"},
+        {"x = y = 1 + 2;","(x = (y = (1 + 2)))"},
+        {"x += 2 * 3;","(x += (2 * 3))"},
+        {"a[i + 1] -= 1;","((a[(i + 1)]) -= 1)"},
+        {"h[\"k\"] /= 2;","((h[\"k\"]) /= 2)"},
+        {"x *= y == z;","(x *= (y == z))"},
+        {"let z = x = 1;","let z = (x = 1);"},
+        {"f(x = 1);","f((x = 1), )"},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        program:=p.ParseProgram()
+        checkErrors(t,p)
+        if program.String()!=tt.expected {
+            t.Errorf("%q: expected %q got %q",tt.input,tt.expected,program.String())
+        }
+    }
+}
+
+func TestBadAssignTarget(t *testing.T) {
+    tests:=[]struct{
+        input string
+        start string
+        end string
+    }{
+        {"1 = 2;","1:1","1:2"},
+        {"f() = 2;","1:1","1:4"},
+        {"a + b = 2;","1:1","1:6"},
+        {"let x = -y += 1;","1:9","1:11"},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        p.ParseProgram()
+
+        diags:=p.Diagnostics()
+        if len(diags)!=1 {
+            t.Fatalf("%q: expected 1 diagnostic got %v",tt.input,p.ShowErrors())
+        }
+        d:=diags[0]
+        if d.Code!=ErrBadAssignTarget || d.Span.Start.String()!=tt.start || d.Span.End.String()!=tt.end {
+            t.Errorf("%q: expected %s at %s-%s got %s-%s %s",tt.input,ErrBadAssignTarget,tt.start,tt.end,d.Span.Start,d.Span.End,d.Error())
+        }
+    }
+}
+
+func TestConstStatements(t *testing.T) {
+    p:=New(lexer.New("const x = 5; let y = x;"))
+    program:=p.ParseProgram()
+    checkErrors(t,p)
+
+    if program.String()!="const x = 5;let y = x;" {
+        t.Errorf("Expected the const to print as one got %q",program.String())
+    }
+    if !program.Statements[0].(*ast.LetStmt).IsConst() || program.Statements[1].(*ast.LetStmt).IsConst() {
+        t.Errorf("Expected only the first statement to be a const")
+    }
+}
+
+func TestConstChecks(t *testing.T) {
+    tests:=[]struct{
+        input string
+        code string // empty if the program is fine
+        start string
+    }{
+        {"const x = 1; x = 2;",ErrAssignConst,"1:14"},
+        {"const x = 1; x += 2;",ErrAssignConst,"1:14"},
+        {"const x = 1; let x = 2;",ErrRedeclareConst,"1:18"},
+        {"const x = 1; const x = 2;",ErrRedeclareConst,"1:20"},
+        {"const x = 1; for (x in [1]) { }",ErrRedeclareConst,"1:19"},
+        {"const x = 1; if (true) { let x = 2; }",ErrRedeclareConst,"1:30"},
+        {"const x = 1; let f = fn() { x = 2 };",ErrAssignConst,"1:29"},
+        {"const x = 1; let f = fn() { fn() { x *= 2 } };",ErrAssignConst,"1:36"},
+        // the function can be called once the const exists
+        {"let f = fn() { x = 1 }; const x = 2;",ErrAssignConst,"1:16"},
+        {"let f = fn() { const y = 1; y = 2 };",ErrAssignConst,"1:29"},
+        // a function body is a scope of its own
+        {"const x = 1; let f = fn(x) { x = 2 };","",""},
+        {"const x = 1; let f = fn() { let x = 0; x = 2 };","",""},
+        {"let f = fn() { const x = 0; x }; let x = 1; x = 2;","",""},
+        // the binding is constant, the array it holds is not
+        {"const xs = [1]; xs[0] = 2;","",""},
+        {"let x = 1; x = 2; const x = 3;","",""},
+        // a loop body is run again without a scope of its own
+        {"let i = 0; while (i < 3) { if (i > 0) { c = 99; } const c = i; i += 1 }",ErrConstInLoop,"1:57"},
+        {"for (x in [1]) { if (true) { const y = x; } }",ErrConstInLoop,"1:36"},
+        {"let f = fn() { for (;;) { const k = 1; break } };",ErrConstInLoop,"1:33"},
+        {"while (true) { let f = fn() { const k = 1; k }; break }","",""},
+        {"const n = 3; for (let i = 0; i < n; i += 1) { n + i }","",""},
+    }
+
+    for _,tt:=range tests {
+        p:=New(lexer.New(tt.input))
+        p.ParseProgram()
+        diags:=p.Diagnostics()
+
+        if tt.code=="" {
+            if len(diags)!=0 {
+                t.Errorf("%q: expected no errors got %v",tt.input,p.ShowErrors())
+            }
+            continue
+        }
+        if len(diags)!=1 {
+            t.Errorf("%q: expected 1 diagnostic got %v",tt.input,p.ShowErrors())
+            continue
+        }
+        if diags[0].Code!=tt.code || diags[0].Span.Start.String()!=tt.start {
+            t.Errorf("%q: expected %s at %s got %s",tt.input,tt.code,tt.start,diags[0].Error())
+        }
+    }
+}
+
+func TestConstChecksNeedAValidTree(t *testing.T) {
+    p:=New(lexer.New("const x = 1; x = ;"))
+    p.ParseProgram()
+    for _,d:=range p.Diagnostics() {
+        if d.Code==ErrAssignConst {
+            t.Errorf("The const check ran on a program with syntax errors: %s",d.Error())
+        }
+    }
+}
+
+func TestKeepConsts(t *testing.T) {
+    consts:=map[string]token.Position{}
+    inputs:=[]struct{
+        input string
+        errors int
+    }{
+        {"const x = 1;",0},
+        {"const y = 2; y = 3;",1}, // not kept, the input had errors
+        {"x = 2;",1},
+        {"let y = 1;",0},
+    }
+    for _,in:=range inputs {
+        p:=New(lexer.New(in.input))
+        p.KeepConsts(consts)
+        p.ParseProgram()
+        if len(p.Diagnostics())!=in.errors {
+            t.Errorf("%q: expected %d errors got %v",in.input,in.errors,p.ShowErrors())
+        }
+    }
+    if _,ok:=consts["x"];!ok || len(consts)!=1 {
+        t.Errorf("Expected only x to be kept got %v",consts)
+    }
+}
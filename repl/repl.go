@@ -4,38 +4,149 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
+	"maps"
+	"strings"
 
+	"github.com/Sumz-K/Go-Interpreter/diag"
+	"github.com/Sumz-K/Go-Interpreter/evaluator"
 	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
 	"github.com/Sumz-K/Go-Interpreter/parser"
-	//"github.com/Sumz-K/Go-Interpreter/token"
-	// "github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/token"
 )
-func Start(in *os.File, out io.Writer) { 
-    fmt.Print("Starting parser\n")
+
+const (
+    PROMPT=">> "
+    CONTINUATION_PROMPT=".. " // shown while an input spans several lines
+)
+
+// Start reads Monkey code from in and writes the value of every input to out.
+// An input ends at the first line that leaves no bracket open and does not end
+// in an operator, an empty line forces it to end anyway. Bindings made by one
+// input are visible to the next, and so are its consts. puts writes to out too
+func Start(in io.Reader, out io.Writer) {
+    saved := object.Output
+    object.Output = out
+    defer func() { object.Output = saved }()
+
     scanner := bufio.NewScanner(in)
-    for { 
-        scanned := scanner.Scan() 
+    env := object.NewEnvironment()
+    consts := map[string]token.Position{}
+    inputs := 0
+    var input strings.Builder
+
+    for {
+        if input.Len()==0 {
+            io.WriteString(out, PROMPT)
+        } else {
+            io.WriteString(out, CONTINUATION_PROMPT)
+        }
+
+        scanned := scanner.Scan()
         if !scanned {
+            if input.Len()!=0 { // run what we have rather than silently dropping it
+                io.WriteString(out, "\n")
+                inputs++
+                eval(out, input.String(), env, consts, inputs)
+            }
             return
         }
         line := scanner.Text()
-        l := lexer.New(line)
-        p := parser.New(l)
-        program := p.ParseProgram()
-        if len(p.ShowErrors()) != 0 {
-            printParserErrors(out, p.ShowErrors())
+
+        if input.Len()==0 && strings.TrimSpace(line)=="" {
             continue
         }
-        io.WriteString(out, program.String())
+        forced := input.Len()!=0 && strings.TrimSpace(line)==""
+        input.WriteString(line)
+        input.WriteString("\n")
+
+        if !forced && IsIncomplete(input.String()) {
+            continue
+        }
+        inputs++
+        eval(out, input.String(), env, consts, inputs)
+        input.Reset()
+    }
+}
+
+// n counts the inputs of the session, the consts an input declares are
+// remembered as declared in input n so that notes about them say which
+func eval(out io.Writer, src string, env *object.Environment, consts map[string]token.Position, n int) {
+    l := lexer.New(src)
+    p := parser.New(l)
+    declared := maps.Clone(consts)
+    p.KeepConsts(declared)
+    program := p.ParseProgram()
+    if len(p.Diagnostics()) != 0 {
+        printParserErrors(out, src, p.Diagnostics())
+        return
+    }
+
+    // a runtime error can stop the input before it gets to a const, which then
+    // is not a const at all. Only names the input bound itself are sure to have been
+    boundBefore := map[string]bool{}
+    for name := range declared {
+        _, boundBefore[name] = env.Get(name)
+    }
+
+    evaluated := evaluator.Eval(program, env)
+    failed := object.Is(evaluated, object.ERROR_OBJ)
+    for name, pos := range declared {
+        if _, ok := consts[name]; ok {
+            continue
+        }
+        if _, bound := env.Get(name); failed && (boundBefore[name] || !bound) {
+            continue
+        }
+        pos.File = fmt.Sprintf("<input %d>", n)
+        consts[name] = pos
+    }
+
+    if evaluated != nil {
+        io.WriteString(out, evaluated.Inspect())
         io.WriteString(out, "\n")
     }
 }
 
-func printParserErrors(out io.Writer, errors []string) { 
-    for _, msg := range errors {
-        io.WriteString(out, "\t"+msg+"\n")
+// IsIncomplete reports whether src looks like the beginning of an input that
+// continues on the next line: a (, { or [ left open or a trailing operator, comma or else
+func IsIncomplete(src string) bool {
+    l := lexer.New(src)
+    depth := 0
+    var last token.Token
+
+    for tok := range l.Tokens() {
+        switch tok.Type {
+        case token.LPAREN, token.LBRACE, token.LBRACKET:
+            depth++
+        case token.RPAREN, token.RBRACE, token.RBRACKET:
+            depth--
+        }
+        last = tok
+    }
+
+    for _, err := range l.Errors() {
+        if err.Code == lexer.ErrUnterminatedComment { // the rest of the comment is still to come
+            return true
+        }
     }
+    if depth > 0 {
+        return true
+    }
+    if depth < 0 { // too many closing brackets, more input will not help
+        return false
+    }
+    switch last.Type {
+    case token.ASSIGN, token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.BANG,
+        token.LT, token.GT, token.EQ, token.NOTEQ, token.AND, token.OR, token.COMMA, token.ELSE,
+        token.LTE, token.GTE, token.PERCENT, token.POWER, token.AMPERSAND, token.PIPE,
+        token.CARET, token.TILDE, token.SHL, token.SHR, token.PLUS_ASSIGN, token.MINUS_ASSIGN,
+        token.ASTERISK_ASSIGN, token.SLASH_ASSIGN:
+        return true
+    }
+    return false
 }
 
-    
\ No newline at end of file
+func printParserErrors(out io.Writer, src string, diags []diag.Diagnostic) {
+    diag.RenderAll(out, src, diags)
+}
@@ -0,0 +1,107 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected bool
+	}{
+		{"let x = 5;",false},
+		{"let x =",true},
+		{"let add = fn(x, y) {",true},
+		{"let add = fn(x, y) {\n x + y\n};",false},
+		{"add(1,",true},
+		{"5 +",true},
+		{"if (x) { 1 } else",true},
+		{"}",false},
+		{"let x = 1; /* still",true},
+		{"let x = 1; // done",false},
+		{"x +=",true},
+		{"a[0] =",true},
+		{"",false},
+	}
+
+	for _,tt:=range tests {
+		if IsIncomplete(tt.input)!=tt.expected {
+			t.Errorf("IsIncomplete(%q) expected %t",tt.input,tt.expected)
+		}
+	}
+}
+
+func TestStartKeepsBindingsAcrossInputs(t *testing.T) {
+	input:=`let add = fn(x, y) {
+  x + y
+};
+let five = 5;
+add(five,
+  10)
+five * 2
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input),&out)
+
+	expected:=">> .. .. >> >> .. 15\n>> 10\n>> "
+	if out.String()!=expected {
+		t.Errorf("Wrong output, expected %q got %q",expected,out.String())
+	}
+}
+
+func TestStartKeepsConstsAcrossInputs(t *testing.T) {
+	input:="const limit = 3;\nlimit = 4\nlimit\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input),&out)
+
+	if !strings.Contains(out.String(),"error[E0006]") || !strings.HasSuffix(out.String(),">> 3\n>> ") {
+		t.Errorf("Expected the assignment to be rejected and limit to stay 3, got %q",out.String())
+	}
+}
+
+func TestStartOnlyKeepsConstsThatWereBound(t *testing.T) {
+	input:="puts(1 + true); const q = 1\nlet q = 2\nconst r = 1; r + true\nlet r = 5\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input),&out)
+
+	if strings.Contains(out.String(),"`q` is already a const") {
+		t.Errorf("Expected q to be free after the input declaring it failed first, got %q",out.String())
+	}
+	if !strings.Contains(out.String(),"`r` is declared at <input 3>:1:7") {
+		t.Errorf("Expected r to stay a const declared in input 3, got %q",out.String())
+	}
+}
+
+func TestStartPrintsToOut(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("puts(\"hi\")\n"),&out)
+
+	if out.String()!=">> hi\nnull\n>> " {
+		t.Errorf("Expected puts to write to out, got %q",out.String())
+	}
+}
+
+func TestStartReportsErrors(t *testing.T) {
+	input:="let x 5;\nfoo\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input),&out)
+
+	if !strings.Contains(out.String(),"error[E0001]: expected next token to be `=`") {
+		t.Errorf("Expected a rendered parser error got %q",out.String())
+	}
+	if !strings.Contains(out.String(),"ERROR: identifier not found: foo") {
+		t.Errorf("Expected a runtime error got %q",out.String())
+	}
+}
+
+func TestEmptyLineEndsInput(t *testing.T) {
+	input:="let x = (1\n\n3\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input),&out)
+
+	if !strings.Contains(out.String(),"error[") || !strings.HasSuffix(out.String(),"3\n>> ") {
+		t.Errorf("Expected the empty line to force evaluation got %q",out.String())
+	}
+}
@@ -1,5 +1,7 @@
 package token 
 
+import "fmt"
+
 
 const (
     ASSIGN = "="
@@ -10,33 +12,60 @@ const (
     BANG = "!"
     LT = "<"
     GT = ">"
+    LTE = "<="
+    GTE = ">="
+    PERCENT = "%"
+    POWER = "**"
+    AMPERSAND = "&"
+    PIPE = "|"
+    CARET = "^"
+    TILDE = "~"
+    SHL = "<<"
+    SHR = ">>"
+    PLUS_ASSIGN = "+="
+    MINUS_ASSIGN = "-="
+    ASTERISK_ASSIGN = "*="
+    SLASH_ASSIGN = "/="
 
     EQ = "=="
-    NOTEQ = "!=`"
+    NOTEQ = "!="
+    AND = "&&"
+    OR = "||"
     IDENTIFIER="IDENT"
     INTEGER="INT"
+    STRING="STRING"
 
     COMMA=","
     SEMICOLON=";"
+    COLON=":"
 
     LPAREN="("
     RPAREN=")"
     LBRACE="{"
     RBRACE="}"
+    LBRACKET="["
+    RBRACKET="]"
 
     EOF="EOF"
     ILLEGAL="ILLEGAL"
+    COMMENT="COMMENT" // only returned by a lexer created with lexer.WithComments
 
 
     //keywords
 
     LET="LET"
+    CONST="CONST"
     FUNC="FUNCTION"
     IF="IF"
     ELSE="ELSE"
     TRUE="TRUE"
     FALSE="FALSE"
     RETURN="RETURN"
+    WHILE="WHILE"
+    FOR="FOR"
+    IN="IN"
+    BREAK="BREAK"
+    CONTINUE="CONTINUE"
 
 
 )
@@ -45,17 +74,53 @@ type TokenType string
 type Token struct {
     Type TokenType
     Value string
+    Pos Position // where the token starts
+    End Position // just past the last character of the token
+}
+
+// a location in the source, Line and Column start at 1 and Offset is the byte offset from the start of the input
+type Position struct {
+    File string
+    Line int
+    Column int
+    Offset int
+}
+
+// the zero Position is used for nodes that were not built from source
+func (p Position) IsValid() bool {
+    return p.Line>0
+}
+
+// file:line:column, or just line:column when there is no file name
+func (p Position) String() string {
+    if !p.IsValid() {
+        if p.File!="" {
+            return p.File
+        }
+        return "-"
+    }
+    s:=fmt.Sprintf("%d:%d",p.Line,p.Column)
+    if p.File!="" {
+        s=p.File+":"+s
+    }
+    return s
 }
 
 
 var keywords = map[string]TokenType {
     "let":LET,
+    "const":CONST,
     "fn":FUNC,
     "return":RETURN,
     "if":IF,
     "else":ELSE,
     "true":TRUE,
     "false":FALSE,
+    "while":WHILE,
+    "for":FOR,
+    "in":IN,
+    "break":BREAK,
+    "continue":CONTINUE,
 }
 
 func CheckID(id string) TokenType { //checks if the id is a keyword or not
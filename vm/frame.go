@@ -0,0 +1,22 @@
+package vm
+
+import (
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+// Frame is one active call. Its locals live on the stack starting at
+// basePointer, the callee itself sits in the slot right below
+type Frame struct {
+	cl *object.Closure
+	ip int // the instruction being executed, -1 before the first one
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl,ip: -1,basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,580 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/compiler"
+	"github.com/Sumz-K/Go-Interpreter/object"
+)
+
+const (
+	StackSize=2048
+	GlobalsSize=1<<16
+	MaxFrames=1024
+)
+
+var (
+	NULL=object.NULL
+	TRUE=object.TRUE
+	FALSE=object.FALSE
+)
+
+type VM struct {
+	constants []object.Object
+	globals []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp int // always points to the next free slot, the top of the stack is stack[sp-1]
+
+	frames []*Frame
+	framesIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode,make([]object.Object,GlobalsSize))
+}
+
+// NewWithGlobalsStore runs bytecode against globals left behind by an earlier
+// vm, a repl passes the same store to every line
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn:=&object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure:=&object.Closure{Fn: mainFn}
+	frames:=make([]*Frame,MaxFrames)
+	frames[0]=NewFrame(mainClosure,0)
+
+	return &VM{
+		constants: bytecode.Constants,
+		globals: globals,
+		globalNames: bytecode.Globals,
+		stack: make([]object.Object,StackSize),
+		frames: frames,
+		framesIndex: 1,
+	}
+}
+
+// the value of the last expression statement, which has just been popped off the stack
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp>=StackSize {
+		return nil
+	}
+	return vm.stack[vm.sp]
+}
+
+// Run executes until the program ends, returns at the top level or fails.
+// Runtime errors use the same messages as the evaluator
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip<len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip:=vm.currentFrame().ip
+		ins:=vm.currentFrame().Instructions()
+		op:=code.Opcode(ins[ip])
+
+		var err error
+		switch op {
+		case code.OpConstant:
+			constIndex:=code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip+=2
+			err=vm.push(vm.constants[constIndex])
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd,code.OpSub,code.OpMul,code.OpDiv,
+			code.OpEqual,code.OpNotEqual,code.OpGreaterThan,code.OpLessThan,
+			code.OpLessEqual,code.OpGreaterEqual,code.OpMod,code.OpPow,
+			code.OpBitAnd,code.OpBitOr,code.OpBitXor,code.OpShiftLeft,code.OpShiftRight:
+			err=vm.executeBinaryOperation(op)
+		case code.OpMinus:
+			operand:=vm.pop()
+			if operand.Type()!=object.INTEGER_OBJ {
+				return fmt.Errorf("unknown operator: -%s",operand.Type())
+			}
+			err=vm.push(&object.Integer{Value: -operand.(*object.Integer).Value})
+		case code.OpBang:
+			err=vm.push(object.NativeBoolToObject(!isTruthy(vm.pop())))
+		case code.OpBitNot:
+			operand:=vm.pop()
+			if operand.Type()!=object.INTEGER_OBJ {
+				return fmt.Errorf("unknown operator: ~%s",operand.Type())
+			}
+			err=vm.push(&object.Integer{Value: ^operand.(*object.Integer).Value})
+
+		case code.OpTrue:
+			err=vm.push(TRUE)
+		case code.OpFalse:
+			err=vm.push(FALSE)
+		case code.OpNull:
+			err=vm.push(NULL)
+
+		case code.OpJump:
+			pos:=int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip=pos-1
+		case code.OpJumpNotTruthy:
+			pos:=int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip+=2
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip=pos-1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex:=code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip+=2
+			vm.globals[globalIndex]=vm.pop()
+		case code.OpGetGlobal:
+			globalIndex:=code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip+=2
+			err=vm.pushBound(vm.globals[globalIndex],vm.globalNames,int(globalIndex))
+		case code.OpSetLocal:
+			localIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)]=vm.pop()
+		case code.OpGetLocal:
+			localIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			err=vm.pushBound(vm.stack[vm.currentFrame().basePointer+int(localIndex)],vm.currentFrame().cl.Fn.LocalNames,int(localIndex))
+		case code.OpGetBuiltin:
+			builtinIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			err=vm.push(object.Builtins()[builtinIndex])
+		case code.OpGetFree:
+			freeIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			err=vm.pushBound(vm.currentFrame().cl.Free[freeIndex],vm.currentFrame().cl.Fn.FreeNames,int(freeIndex))
+		case code.OpGetLocalCell:
+			localIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			err=vm.pushBound(vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*object.Cell).Value,vm.currentFrame().cl.Fn.LocalNames,int(localIndex))
+		case code.OpSetLocalCell:
+			localIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*object.Cell).Value=vm.pop()
+		case code.OpGetFreeCell:
+			freeIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			cell,cellErr:=vm.freeCell(int(freeIndex))
+			if cellErr!=nil {
+				return cellErr
+			}
+			err=vm.pushBound(cell.Value,vm.currentFrame().cl.Fn.FreeNames,int(freeIndex))
+		case code.OpSetFreeCell:
+			freeIndex:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			cell,cellErr:=vm.freeCell(int(freeIndex))
+			if cellErr!=nil {
+				return cellErr
+			}
+			cell.Value=vm.pop()
+
+		case code.OpArray:
+			numElements:=int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip+=2
+			err=vm.buildArray(numElements)
+		case code.OpHash:
+			numElements:=int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip+=2
+			err=vm.buildHash(numElements)
+		case code.OpIndex:
+			index:=vm.pop()
+			left:=vm.pop()
+			err=vm.executeIndexExpression(left,index)
+		case code.OpSetIndex:
+			value:=vm.pop()
+			index:=vm.pop()
+			left:=vm.pop()
+			err=vm.executeSetIndex(left,index,value)
+		case code.OpDupPair:
+			err=vm.push(vm.stack[vm.sp-2])
+			if err==nil {
+				err=vm.push(vm.stack[vm.sp-2])
+			}
+		case code.OpIterate:
+			iterable:=vm.pop()
+			items,ok:=object.Items(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s",iterable.Type())
+			}
+			err=vm.push(&object.Array{Elements: items})
+
+		case code.OpCall:
+			numArgs:=code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip+=1
+			err=vm.executeCall(int(numArgs))
+		case code.OpReturnValue:
+			returnValue:=vm.pop()
+			if vm.framesIndex==1 {
+				// a return at the top level ends the program with that value
+				vm.stack[vm.sp]=returnValue
+				return nil
+			}
+			frame:=vm.popFrame()
+			vm.sp=frame.basePointer-1
+			err=vm.push(returnValue)
+		case code.OpReturn:
+			frame:=vm.popFrame()
+			vm.sp=frame.basePointer-1
+			err=vm.push(NULL)
+		case code.OpClosure:
+			constIndex:=code.ReadUint16(ins[ip+1:])
+			numFree:=code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip+=3
+			err=vm.pushClosure(int(constIndex),int(numFree))
+		case code.OpCurrentClosure:
+			err=vm.push(vm.currentFrame().cl)
+
+		default:
+			def,lookupErr:=code.Lookup(byte(op))
+			if lookupErr!=nil {
+				return lookupErr
+			}
+			return fmt.Errorf("opcode %s not implemented",def.Name)
+		}
+
+		if err!=nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex>=MaxFrames {
+		return fmt.Errorf("stack overflow: more than %d nested calls",MaxFrames)
+	}
+	vm.frames[vm.framesIndex]=f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp>=StackSize {
+		return fmt.Errorf("stack overflow: more than %d values on the stack",StackSize)
+	}
+	vm.stack[vm.sp]=o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o:=vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+var operators=map[code.Opcode]string{
+	code.OpAdd: "+",
+	code.OpSub: "-",
+	code.OpMul: "*",
+	code.OpDiv: "/",
+	code.OpEqual: "==",
+	code.OpNotEqual: "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan: "<",
+	code.OpLessEqual: "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpMod: "%",
+	code.OpPow: "**",
+	code.OpBitAnd: "&",
+	code.OpBitOr: "|",
+	code.OpBitXor: "^",
+	code.OpShiftLeft: "<<",
+	code.OpShiftRight: ">>",
+}
+
+// the checks happen in the same order as in the evaluator, so both report the same error
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right:=vm.pop()
+	left:=vm.pop()
+	operator:=operators[op]
+
+	switch {
+	case left.Type()==object.INTEGER_OBJ && right.Type()==object.INTEGER_OBJ:
+		return vm.executeIntegerOperation(operator,left,right)
+	case left.Type()==object.STRING_OBJ && right.Type()==object.STRING_OBJ:
+		return vm.executeStringOperation(operator,left,right)
+	case left.Type()!=right.Type():
+		return fmt.Errorf("type mismatch: %s %s %s",left.Type(),operator,right.Type())
+	// booleans and null are singletons so pointer comparison is enough
+	case op==code.OpEqual:
+		return vm.push(object.NativeBoolToObject(left==right))
+	case op==code.OpNotEqual:
+		return vm.push(object.NativeBoolToObject(left!=right))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerOperation(operator string, left,right object.Object) error {
+	leftVal:=left.(*object.Integer).Value
+	rightVal:=right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return vm.push(&object.Integer{Value: leftVal+rightVal})
+	case "-":
+		return vm.push(&object.Integer{Value: leftVal-rightVal})
+	case "*":
+		return vm.push(&object.Integer{Value: leftVal*rightVal})
+	case "/":
+		if rightVal==0 {
+			return fmt.Errorf("division by zero: %d / %d",leftVal,rightVal)
+		}
+		return vm.push(&object.Integer{Value: leftVal/rightVal})
+	case "%":
+		if rightVal==0 {
+			return fmt.Errorf("division by zero: %d %% %d",leftVal,rightVal)
+		}
+		return vm.push(&object.Integer{Value: leftVal%rightVal})
+	case "**":
+		if rightVal<0 {
+			return fmt.Errorf("negative exponent: %d ** %d",leftVal,rightVal)
+		}
+		return vm.push(&object.Integer{Value: intPow(leftVal,rightVal)})
+	case "&":
+		return vm.push(&object.Integer{Value: leftVal&rightVal})
+	case "|":
+		return vm.push(&object.Integer{Value: leftVal|rightVal})
+	case "^":
+		return vm.push(&object.Integer{Value: leftVal^rightVal})
+	case "<<",">>":
+		if rightVal<0 {
+			return fmt.Errorf("negative shift count: %d %s %d",leftVal,operator,rightVal)
+		}
+		if operator=="<<" {
+			return vm.push(&object.Integer{Value: leftVal<<uint64(rightVal)})
+		}
+		return vm.push(&object.Integer{Value: leftVal>>uint64(rightVal)})
+	case ">":
+		return vm.push(object.NativeBoolToObject(leftVal>rightVal))
+	case "<":
+		return vm.push(object.NativeBoolToObject(leftVal<rightVal))
+	case ">=":
+		return vm.push(object.NativeBoolToObject(leftVal>=rightVal))
+	case "<=":
+		return vm.push(object.NativeBoolToObject(leftVal<=rightVal))
+	case "==":
+		return vm.push(object.NativeBoolToObject(leftVal==rightVal))
+	case "!=":
+		return vm.push(object.NativeBoolToObject(leftVal!=rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+// same as the evaluator's, wrapping around on overflow
+func intPow(base,exp int64) int64 {
+	result:=int64(1)
+	for exp>0 {
+		if exp&1==1 {
+			result*=base
+		}
+		base*=base
+		exp>>=1
+	}
+	return result
+}
+
+func (vm *VM) executeStringOperation(operator string, left,right object.Object) error {
+	leftVal:=left.(*object.String).Value
+	rightVal:=right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return vm.push(&object.String{Value: leftVal+rightVal})
+	case "==":
+		return vm.push(object.NativeBoolToObject(leftVal==rightVal))
+	case "!=":
+		return vm.push(object.NativeBoolToObject(leftVal!=rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s",left.Type(),operator,right.Type())
+	}
+}
+
+func (vm *VM) buildArray(numElements int) error {
+	elements:=make([]object.Object,numElements)
+	copy(elements,vm.stack[vm.sp-numElements:vm.sp])
+	vm.sp-=numElements
+	return vm.push(&object.Array{Elements: elements})
+}
+
+// keys and values alternate on the stack in source order, a repeated key keeps the last value
+func (vm *VM) buildHash(numElements int) error {
+	hash:=object.NewHash()
+	start:=vm.sp-numElements
+
+	for i:=start;i<vm.sp;i+=2 {
+		key,ok:=vm.stack[i].(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s",vm.stack[i].Type())
+		}
+		hash.Set(key,vm.stack[i+1])
+	}
+	vm.sp=start
+	return vm.push(hash)
+}
+
+func (vm *VM) executeIndexExpression(left,index object.Object) error {
+	switch {
+	case left.Type()==object.ARRAY_OBJ && index.Type()==object.INTEGER_OBJ:
+		elements:=left.(*object.Array).Elements
+		idx:=index.(*object.Integer).Value
+		if idx<0 || idx>=int64(len(elements)) {
+			return fmt.Errorf("index out of range: %d with length %d",idx,len(elements))
+		}
+		return vm.push(elements[idx])
+	case left.Type()==object.HASH_OBJ:
+		key,ok:=index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s",index.Type())
+		}
+		value,ok:=left.(*object.Hash).Get(key)
+		if !ok {
+			return vm.push(NULL)
+		}
+		return vm.push(value)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]",left.Type(),index.Type())
+	}
+}
+
+// arrays and hashes are changed in place, the value assigned is pushed back
+func (vm *VM) executeSetIndex(left,index,value object.Object) error {
+	switch {
+	case left.Type()==object.ARRAY_OBJ && index.Type()==object.INTEGER_OBJ:
+		elements:=left.(*object.Array).Elements
+		idx:=index.(*object.Integer).Value
+		if idx<0 || idx>=int64(len(elements)) {
+			return fmt.Errorf("index out of range: %d with length %d",idx,len(elements))
+		}
+		elements[idx]=value
+	case left.Type()==object.HASH_OBJ:
+		key,ok:=index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s",index.Type())
+		}
+		left.(*object.Hash).Set(key,value)
+	default:
+		return fmt.Errorf("index assignment not supported: %s[%s]",left.Type(),index.Type())
+	}
+	return vm.push(value)
+}
+
+// the callee sits below its numArgs arguments on the stack
+func (vm *VM) executeCall(numArgs int) error {
+	callee:=vm.stack[vm.sp-1-numArgs]
+
+	switch callee:=callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee,numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee,numArgs)
+	default:
+		return fmt.Errorf("not a function: %s",callee.Type())
+	}
+}
+
+// the arguments already on the stack become the first locals of the new frame
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn:=cl.Fn
+	if numArgs!=fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",fn.NumParameters,numArgs)
+	}
+
+	frame:=NewFrame(cl,vm.sp-numArgs)
+	if err:=vm.pushFrame(frame);err!=nil {
+		return err
+	}
+
+	if frame.basePointer+fn.NumLocals>=StackSize {
+		return fmt.Errorf("stack overflow: more than %d values on the stack",StackSize)
+	}
+	// locals that are not parameters start out empty, not with whatever an earlier call left there
+	for i:=frame.basePointer+numArgs;i<frame.basePointer+fn.NumLocals;i++ {
+		vm.stack[i]=nil
+	}
+	// every call gets cells of its own, a parameter's cell starts out with the argument
+	// and any other starts out empty like the slot would
+	for _,slot:=range fn.Cells {
+		cell:=&object.Cell{}
+		if slot<numArgs {
+			cell.Value=vm.stack[frame.basePointer+slot]
+		}
+		vm.stack[frame.basePointer+slot]=cell
+	}
+	vm.sp=frame.basePointer+fn.NumLocals
+	return nil
+}
+
+// a variable whose let has not run holds nil, reading it is the error the
+// evaluator gives for a name it cannot find. names is the table of the slot's
+// scope, a function built without one still gets an error rather than a panic
+func (vm *VM) pushBound(value object.Object, names []string, index int) error {
+	if value!=nil {
+		return vm.push(value)
+	}
+	if index<len(names) {
+		return fmt.Errorf("identifier not found: %s",names[index])
+	}
+	return fmt.Errorf("identifier not found: variable %d",index)
+}
+
+// which free variables hold cells is up to the function that made the closure,
+// something the loader cannot check for a file the way the compiler makes sure of it
+func (vm *VM) freeCell(index int) (*object.Cell,error) {
+	cell,ok:=vm.currentFrame().cl.Free[index].(*object.Cell)
+	if !ok {
+		return nil,fmt.Errorf("free variable %d is not a cell",index)
+	}
+	return cell,nil
+}
+
+// the free values are copied off the stack, the closure keeps them after the
+// frame that computed them has returned
+func (vm *VM) pushClosure(constIndex,numFree int) error {
+	fn,ok:=vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %s",object.TypeOf(vm.constants[constIndex]))
+	}
+
+	free:=make([]object.Object,numFree)
+	copy(free,vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp-=numFree
+
+	return vm.push(&object.Closure{Fn: fn,Free: free})
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args:=make([]object.Object,numArgs)
+	copy(args,vm.stack[vm.sp-numArgs:vm.sp])
+
+	result:=builtin.Call(args...)
+	vm.sp=vm.sp-numArgs-1
+
+	if errObj,ok:=result.(*object.Error);ok {
+		return fmt.Errorf("%s",errObj.Message)
+	}
+	if result==nil {
+		return vm.push(NULL)
+	}
+	return vm.push(result)
+}
+
+// null and false are falsy, everything else is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL,FALSE:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,467 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sumz-K/Go-Interpreter/ast"
+	"github.com/Sumz-K/Go-Interpreter/code"
+	"github.com/Sumz-K/Go-Interpreter/compiler"
+	"github.com/Sumz-K/Go-Interpreter/evaluator"
+	"github.com/Sumz-K/Go-Interpreter/lexer"
+	"github.com/Sumz-K/Go-Interpreter/object"
+	"github.com/Sumz-K/Go-Interpreter/parser"
+)
+
+type vmTestCase struct {
+	input string
+	expected interface{} // int, bool, string, []int, map[int]int or nil for null
+}
+
+func parse(input string) *ast.Program {
+	l:=lexer.New(input)
+	p:=parser.New(l)
+	return p.ParseProgram()
+}
+
+func runVM(t *testing.T, input string) (object.Object,error) {
+	t.Helper()
+	comp:=compiler.New()
+	if err:=comp.Compile(parse(input));err!=nil {
+		t.Fatalf("Compiler error for %q: %s",input,err)
+	}
+	vm:=New(reload(t,input,comp.Bytecode()))
+	err:=vm.Run()
+	return vm.LastPoppedStackElem(),err
+}
+
+// programs run the way a .mkc file of them would, which also puts everything
+// the compiler emits through the checks of the loader
+func reload(t *testing.T, input string, bytecode *compiler.Bytecode) *compiler.Bytecode {
+	t.Helper()
+	data,err:=bytecode.MarshalBinary()
+	if err!=nil {
+		t.Fatalf("MarshalBinary for %q: %s",input,err)
+	}
+	loaded:=&compiler.Bytecode{}
+	if err:=loaded.UnmarshalBinary(data);err!=nil {
+		t.Fatalf("The bytecode for %q does not load: %s",input,err)
+	}
+	return loaded
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+	for _,tt:=range tests {
+		result,err:=runVM(t,tt.input)
+		if err!=nil {
+			t.Errorf("vm error for %q: %s",tt.input,err)
+			continue
+		}
+		testExpectedObject(t,tt.input,tt.expected,result)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+	switch expected:=expected.(type) {
+	case int:
+		integer,ok:=actual.(*object.Integer)
+		if !ok || integer.Value!=int64(expected) {
+			t.Errorf("Wrong result for %q, expected %d got %+v",input,expected,actual)
+		}
+	case bool:
+		boolean,ok:=actual.(*object.Boolean)
+		if !ok || boolean.Value!=expected {
+			t.Errorf("Wrong result for %q, expected %t got %+v",input,expected,actual)
+		}
+	case string:
+		str,ok:=actual.(*object.String)
+		if !ok || str.Value!=expected {
+			t.Errorf("Wrong result for %q, expected %q got %+v",input,expected,actual)
+		}
+	case []int:
+		array,ok:=actual.(*object.Array)
+		if !ok || len(array.Elements)!=len(expected) {
+			t.Errorf("Wrong result for %q, expected %v got %+v",input,expected,actual)
+			return
+		}
+		for i,e:=range expected {
+			testExpectedObject(t,input,e,array.Elements[i])
+		}
+	case map[int]int:
+		hash,ok:=actual.(*object.Hash)
+		if !ok || hash.Len()!=len(expected) {
+			t.Errorf("Wrong result for %q, expected %v got %+v",input,expected,actual)
+			return
+		}
+		for k,v:=range expected {
+			value,ok:=hash.Get(&object.Integer{Value: int64(k)})
+			if !ok {
+				t.Errorf("Missing key %d for %q",k,input)
+				continue
+			}
+			testExpectedObject(t,input,v,value)
+		}
+	case nil:
+		if actual!=NULL {
+			t.Errorf("Wrong result for %q, expected null got %+v",input,actual)
+		}
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"1",1},
+		{"1 + 2",3},
+		{"4 / 2 * 3 - 1",5},
+		{"5 * (2 + 10)",60},
+		{"-5 + 10",5},
+		{"-(1 - 3)",2},
+		{"-7 % 3",-1},
+		{"-2 ** 2",-4},
+		{"2 ** 3 ** 2",512},
+		{"2 ** 64",0},
+		{"6 & 3 | 8 ^ 1",11},
+		{"~5",-6},
+		{"1 + 2 << 3",17},
+		{"-16 >> 2",-4},
+		{"1 << 64",0},
+	}
+	runVmTests(t,tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"true",true},
+		{"1 < 2",true},
+		{"1 > 2",false},
+		{"1 == 1",true},
+		{"1 != 1",false},
+		{"1 <= 1",true},
+		{"2 <= 1",false},
+		{"1 >= 2",false},
+		{"2 >= 2",true},
+		{"true == false",false},
+		{"(1 < 2) == true",true},
+		{"!5",false},
+		{"!!true",true},
+		{"!(if (false) { 5; })",true},
+		{`"a" == "a"`,true},
+		{`"a" != "b"`,true},
+	}
+	runVmTests(t,tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"if (true) { 10 }",10},
+		{"if (1 < 2) { 10 } else { 20 }",10},
+		{"if (1 > 2) { 10 } else { 20 }",20},
+		{"if (false) { 10 }",nil},
+		{"if (true) { let a = 1; }",nil},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }",20},
+	}
+	runVmTests(t,tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"true && true",true},
+		{"true && false",false},
+		{"false || true",true},
+		{"false || false",false},
+		{"0 && \"\"",true},
+		{"if (false) { 1 } || false",false},
+		{"let boom = fn() { -true }; false && boom()",false},
+		{"true || 1 + true",true},
+		{"let n = fn(x) { x > 0 && x < 10 }; n(5) && !n(50)",true},
+		{"if (1 < 2 && !false) { 10 } else { 20 }",10},
+	}
+	runVmTests(t,tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let i = 0; while (i < 5) { let i = i + 1; } i",5},
+		{"let s = 0; for (let i = 1; i <= 4; let i = i + 1) { let s = s + i; } s",10},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s * 10 + x; } s",123},
+		{"let n = 0; for (;;) { let n = n + 1; if (n == 3) { break } } n",3},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue } let s = s + x; } s",4},
+		{"let s = 0; for (i in [1, 2]) { for (j in [1, 2, 3]) { if (j == 2) { break } let s = s + i * j; } } s",3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } 0 }; f([1, 5, 7])",5},
+		// loops in a function keep their state in locals
+		{"let sum = fn(xs) { let s = 0; for (x in xs) { let s = s + x; } s }; sum([1, 2, 3]) + sum([10])",16},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i > 9) { return i } } }; f()",10},
+		// a body full of breaks and continues must not leave anything on the stack
+		{"let n = 0; for (i in [1, 2, 3, 4, 5, 6, 7, 8]) { if (i > 6) { break } if (i % 2 == 0) { continue } let n = n + 1; } n",3},
+		{"let n = 0; for (i in [1, 2]) { for (j in [3, 4]) { let n = n + j; } } n",14},
+	}
+	runVmTests(t,tests)
+
+	_,err:=runVM(t,"for (x in 5) { x }")
+	if err==nil || err.Error()!="cannot iterate over INTEGER" {
+		t.Errorf("Expected an error iterating over an integer, got %v",err)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let x = 1; x = 2; x",2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x",6},
+		{"let x = 0; let y = 0; x = y = 7; x + y",14},
+		{"let a = [1, 2, 3]; a[1] = 20; a[2] *= 10; a",[]int{1,20,30}},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a[0]",9},
+		{`let h = {"k": 1}; h["k"] += 1; h["n"] = 5; h["k"] + h["n"]`,7},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x",5},
+		{"let f = fn(n) { n += 1; n }; f(1)",2},
+		{"const base = 10; let f = fn(n) { const k = 2; n * k + base }; f(1)",12},
+		{"let f = fn() { let x = 1; x = x + 1; x }; f()",2},
+		// closures share the variables they assign with the function defining them
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",3},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()",1},
+		{"let f = fn() { let v = 1; let g = fn() { fn() { v *= 10 } }; g()(); g()(); v }; f()",100},
+		{"let f = fn(p) { let get = fn() { p }; p = 7; get() }; f(1)",7},
+		{"let f = fn() { let fs = []; for (let i = 0; i < 3; i += 1) { fs = push(fs, fn() { i }) } fs[0]() }; f()",3},
+		{"let f = fn() { let g = fn(n) { if (n > 0) { g(n - 1) } else { g = 5 } }; g(2); g }; f()",5},
+	}
+	runVmTests(t,tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let one = 1; one",1},
+		{"let one = 1; let two = one + one; one + two",3},
+		{"let a = 1; let a = a + 1; a",2},
+	}
+	runVmTests(t,tests)
+}
+
+func TestStringsArraysHashes(t *testing.T) {
+	tests:=[]vmTestCase{
+		{`"mon" + "key"`,"monkey"},
+		{"[1, 2 * 2, 3 + 3]",[]int{1,4,6}},
+		{"[]",[]int{}},
+		{"{1: 2, 1 + 1: 2 * 2}",map[int]int{1: 2,2: 4}},
+		{"{1: 1, 1: 2}",map[int]int{1: 2}},
+		{"[1, 2, 3][1]",2},
+		{"[[1, 1, 1]][0][0]",1},
+		{"{1: 1, 2: 2}[2]",2},
+		{"{1: 1}[0]",nil},
+	}
+	runVmTests(t,tests)
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let f = fn() { 5 + 10 }; f()",15},
+		{"let f = fn() { return 1; 2 }; f()",1},
+		{"let f = fn() { }; f()",nil},
+		{"let f = fn() { let a = 1; }; f()",nil},
+		{"let sum = fn(a, b) { let c = a + b; c }; sum(1, 2) + sum(3, 4)",10},
+		{"let one = fn() { 1 }; let two = fn() { one() + one() }; two()",2},
+		{"fn(a) { a }(4)",4},
+		{"let g = 10; let f = fn(a) { a + g }; f(1)",11},
+		{`let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; fib(15)`,610},
+		// a locals slot reused by a later call starts out fresh
+		{"let f = fn(x) { if (x) { let y = 1; y } else { 2 } }; f(true); f(false)",2},
+	}
+	runVmTests(t,tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let newClosure = fn(a) { fn() { a } }; let closure = newClosure(99); closure()",99},
+		{"let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); addTwo(3)",5},
+		{"let curry = fn(a) { fn(b) { fn(c) { a + b + c } } }; curry(1)(2)(3)",6},
+		{"let f = fn(a) { let b = a * 2; fn() { let c = 1; fn() { a + b + c } } }; f(1)()()",4},
+		// each call captures its own values
+		{"let k = fn(x) { fn() { x } }; let one = k(1); let two = k(2); one() + two() * 10",21},
+		// a closure keeps working after the frame that made it is gone and its slots are reused
+		{"let k = fn(x) { fn() { x } }; let c = k(5); let junk = fn(a, b, c) { a }; junk(1, 2, 3); c()",5},
+		{"let map = fn(arr, f) { if (len(arr) == 0) { [] } else { push(map(rest(arr), f), f(first(arr))) } }; let scale = fn(n) { fn(x) { x * n } }; map([1, 2], scale(10))",[]int{20,10}},
+	}
+	runVmTests(t,tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) }; countDown(1)",0},
+		{"let wrapper = fn() { let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) }; countDown(5) }; wrapper()",0},
+		{"let sum = fn(n) { let go = fn(i, acc) { if (i > n) { acc } else { go(i + 1, acc + i) } }; go(1, 0) }; sum(10)",55},
+	}
+	runVmTests(t,tests)
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests:=[]vmTestCase{
+		{"return 1; 2",1},
+		{"if (true) { return 3 } 4",3},
+		{"return if (false) { 1 }; 2",nil},
+	}
+	runVmTests(t,tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests:=[]vmTestCase{
+		{`len("héllo")`,5},
+		{"len([1, 2])",2},
+		{"first([])",nil},
+		{"rest([1, 2, 3])",[]int{2,3}},
+		{"push([1], 2)",[]int{1,2}},
+		{"let len = fn(x) { 0 }; len([1])",0},
+	}
+	runVmTests(t,tests)
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+	old:=object.Output
+	object.Output=&out
+	defer func() { object.Output=old }()
+
+	result,err:=runVM(t,`puts("a", 1)`)
+	if err!=nil {
+		t.Fatalf("vm error: %s",err)
+	}
+	testExpectedObject(t,"puts",nil,result)
+	if out.String()!="a\n1\n" {
+		t.Errorf("Expected puts to print %q got %q",`a\n1\n`,out.String())
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests:=[]struct{
+		input string
+		expected string
+	}{
+		{"1 + true","type mismatch: INTEGER + BOOLEAN"},
+		{"-true","unknown operator: -BOOLEAN"},
+		{"true + false","unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`,"unknown operator: STRING - STRING"},
+		{"1 / 0","division by zero: 1 / 0"},
+		{"1 % 0","division by zero: 1 % 0"},
+		{"2 ** -1","negative exponent: 2 ** -1"},
+		{"1 >> -1","negative shift count: 1 >> -1"},
+		{"~true","unknown operator: ~BOOLEAN"},
+		{"[1][1]","index out of range: 1 with length 1"},
+		{"1[0]","index operator not supported: INTEGER[INTEGER]"},
+		{"{[1]: 2}","unusable as hash key: ARRAY"},
+		{"{}[fn() {}]","unusable as hash key: CLOSURE"},
+		{"1()","not a function: INTEGER"},
+		{"fn(a) { a }()","wrong number of arguments: want=1, got=0"},
+		{"let a = [1]; a[1] = 2","index out of range: 1 with length 1"},
+		{`let s = "ab"; s[0] = "c"`,"index assignment not supported: STRING[INTEGER]"},
+		{"let h = {}; h[[]] = 1","unusable as hash key: ARRAY"},
+		{"len(1)","argument 1 (value) to `len` must be STRING or ARRAY or HASH, got INTEGER"},
+		{"let f = fn() { f() }; f()","stack overflow"},
+		{"let f = fn(a, b, c, d) { f(a, b, c, d) }; f(1, 2, 3, 4)","stack overflow"},
+	}
+
+	for _,tt:=range tests {
+		_,err:=runVM(t,tt.input)
+		if err==nil {
+			t.Errorf("Expected an error for %q",tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(),tt.expected) {
+			t.Errorf("Wrong error for %q, expected %q got %q",tt.input,tt.expected,err.Error())
+		}
+	}
+}
+
+// the vm must agree with the evaluator, which is the reference
+func TestMatchesEvaluator(t *testing.T) {
+	inputs:=[]string{
+		"let x = 5; let y = x * 2; [x, y, x + y]",
+		`let greet = fn(name) { "hello " + name }; greet("monkey")`,
+		"let h = {\"a\": 1, true: 2, 3: [4]}; [h[\"a\"], h[true], h[3][0], h[4]]",
+		"let map = fn(arr, f) { if (len(arr) == 0) { [] } else { push(map(rest(arr), f), f(first(arr))) } }; map([1, 2, 3], fn(x) { x * x })",
+		"if (1 == 2) { 1 } else { if (2 == 2) { 2 } }",
+		"let a = [1, 2]; a == a",
+		"[1] == [1]",
+		"1 == true",
+		"null",
+		"let f = fn() { if (true) { return 1 } 2 }; f()",
+		"let f = fn(a) { len(a) }; f({})",
+		"rest([])",
+		"let adder = fn(a) { fn(b) { a + b } }; [adder(1)(2), adder(10)(20)]",
+		"[true && 1, 0 || false, [] && {}, false || if (false) { 1 }]",
+		"true && -true",
+		"[7 % 3, -7 % 3, 2 ** 62, 3 ** 41, -1 >> 63, 5 << 62, ~0, 12 & 10, 12 | 10, 12 ^ 10, 1 <= 2, 2 >= 3]",
+		"true | false",
+		`"a" >= "b"`,
+		"let fact = fn(n) { let go = fn(i) { if (i < 2) { 1 } else { i * go(i - 1) } }; go(n) }; fact(10)",
+		"let out = []; for (k in {\"b\": 1, \"a\": 2}) { let out = push(out, k); } out",
+		"let s = 0; for (let i = 0; i < 10; let i = i + 1) { if (i == 7) { break } if (i % 3 == 0) { continue } let s = s + i; } s",
+		"let w = 0; while (w < 3) { let w = w + 1; } for (x in \"abc\") { x }",
+		"let x = 1; let f = fn() { x += 1 }; [f(), f(), x]",
+		"let mk = fn(start) { let get = fn() { start }; let add = fn(n) { start += n }; [get, add] }; let p = mk(5); p[1](3); [p[0](), mk(1)[0]()]",
+		"let a = [[1, 2], [3]]; a[0][1] -= 2; let h = {}; h[1] = a; h[1][1][0] = true; [a, h]",
+		"let h = {}; h[1] += 1",
+		"let x = 1; x /= 0",
+		// closures share a variable that is bound again, as they share one that is assigned
+		"let mk = fn() { let x = 1; let f = fn() { x }; let x = 2; f() }; puts(mk())",
+		"let mk = fn() { let fs = []; for (i in [1, 2, 3]) { fs = push(fs, fn() { i }) } [fs[0](), fs[2]()] }; mk()",
+		"let mk = fn() { let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 } fs[0]() }; mk()",
+		"let mk = fn(n) { let f = fn() { n }; let n = n * 10; f() }; mk(2)",
+		"let mk = fn() { let f = 0; if (true) { let x = 5; f = fn() { x } } f() }; mk()",
+		"let mk = fn() { if (false) { let x = 1; } let f = fn() { x }; 5 }; mk()",
+		// a let that did not run leaves its name unbound
+		"let f = fn() { if (false) { let x = 1; } x }; puts(f())",
+		"let f = fn() { if (false) { let x = 1; } x + 1 }; f()",
+		"if (false) { let x = 1 }; puts(x)",
+		"let f = fn(n) { if (n > 0) { let x = n; } x }; [f(1), f(0)]",
+		"let f = fn() { if (false) { let x = 1; } let g = fn() { x += 1 }; g() }; f()",
+	}
+
+	for _,input:=range inputs {
+		expected:=evaluator.Eval(parse(input),object.NewEnvironment())
+
+		comp:=compiler.New()
+		if err:=comp.Compile(parse(input));err!=nil {
+			// the evaluator only finds undefined names when it gets to them
+			if errObj,ok:=expected.(*object.Error);!ok || !strings.Contains(errObj.Message,"identifier not found") {
+				t.Errorf("Compiler error for %q: %s",input,err)
+			}
+			continue
+		}
+		vm:=New(reload(t,input,comp.Bytecode()))
+		err:=vm.Run()
+
+		if errObj,ok:=expected.(*object.Error);ok {
+			if err==nil || err.Error()!=errObj.Message {
+				t.Errorf("Error mismatch for %q, evaluator %q vm %v",input,errObj.Message,err)
+			}
+			continue
+		}
+		if err!=nil {
+			t.Errorf("vm error for %q: %s",input,err)
+			continue
+		}
+		if got:=vm.LastPoppedStackElem().Inspect();got!=expected.Inspect() {
+			t.Errorf("Result mismatch for %q, evaluator %s vm %s",input,expected.Inspect(),got)
+		}
+	}
+}
+
+// the loader cannot tell which free values a closure gets are cells, a file that
+// gets it wrong is an error rather than a crash
+func TestFreeValueThatIsNotACell(t *testing.T) {
+	fn:=&object.CompiledFunction{
+		Instructions: append(code.Make(code.OpGetFreeCell,0),code.Make(code.OpReturnValue)...),
+		LocalNames: []string{},
+		FreeNames: []string{"a"},
+	}
+	var main code.Instructions
+	for _,ins:=range []code.Instructions{code.Make(code.OpNull),code.Make(code.OpClosure,0,1),code.Make(code.OpCall,0),code.Make(code.OpPop)} {
+		main = append(main, ins...)
+	}
+	bytecode:=reload(t,"a hand written closure",&compiler.Bytecode{Instructions: main,Constants: []object.Object{fn}})
+
+	err:=New(bytecode).Run()
+	if err==nil || err.Error()!="free variable 0 is not a cell" {
+		t.Errorf("Expected an error for a free value that is not a cell, got %v",err)
+	}
+}